@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/emulator"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/pty"
+	"github.com/charmbracelet/log"
+)
+
+func usage() {
+	flag.PrintDefaults()
+}
+
+func showUsageAndExit(exitCode int) {
+	fmt.Println("Waveshare USB LoRa firmware emulator")
+	fmt.Println("Hex encoded packets typed on stdin are injected as received packets.")
+	usage()
+	os.Exit(exitCode)
+}
+
+func parseVersion(value string) (client.Version, error) {
+	var version client.Version
+	_, err := fmt.Sscanf(value, "%d.%d.%d", &version.Major, &version.Minor, &version.Patch)
+	return version, err
+}
+
+func main() {
+	var link = flag.String("link", "", "Create a symbolic link to the pseudo terminal")
+	var firmwareVersion = flag.String("v", emulator.DEFAULT_VERSION.String(), "Reported firmware version")
+	var rssi = flag.Int("rssi", -120, "Reported RSSI in dBm")
+	var packetRssi = flag.Int("packet-rssi", -80, "RSSI of injected packets in dBm")
+	var packetSnr = flag.Int("packet-snr", 5, "SNR of injected packets in dB")
+	var logLevel = flag.String("l", "info", "Log level")
+	var showHelp = flag.Bool("h", false, "Show help")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showHelp {
+		showUsageAndExit(0)
+	}
+
+	switch *logLevel {
+	case "debug":
+		log.SetLevel(log.DebugLevel)
+	case "info":
+		log.SetLevel(log.InfoLevel)
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	default:
+		log.Fatalf("Invalid log level '%s'", *logLevel)
+	}
+
+	version, err := parseVersion(*firmwareVersion)
+	if err != nil {
+		log.Fatalf("Invalid firmware version '%s'", *firmwareVersion)
+	}
+
+	master, slave, err := pty.Open()
+	if err != nil {
+		log.With("err", err).Fatal("Failed to open pseudo terminal")
+	}
+	defer slave.Close()
+
+	if *link != "" {
+		os.Remove(*link)
+		if err := os.Symlink(slave.Name(), *link); err != nil {
+			log.With("err", err).Fatal("Failed to create symbolic link")
+		}
+		defer os.Remove(*link)
+	}
+
+	radio := emulator.NewRadio()
+	radio.SetVersion(version)
+	radio.SetRssi(int16(*rssi))
+
+	if err := radio.Open(client.NewFileTransport(master)); err != nil {
+		log.Fatal(err)
+	}
+	defer radio.Close()
+
+	go func() {
+		for data := range radio.Transmitted {
+			log.With("packet", hex.EncodeToString(data)).Info("Transmitted")
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			data, err := hex.DecodeString(line)
+			if err != nil {
+				log.With("err", err).Error("Invalid packet")
+				continue
+			}
+
+			if err := radio.InjectPacket(data, int8(*packetRssi), int8(*packetSnr)); err != nil {
+				log.With("err", err).Error("Failed to inject packet")
+			}
+		}
+	}()
+
+	log.With("port", slave.Name()).Info("Fake radio is up and running")
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+}
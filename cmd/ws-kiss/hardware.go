@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+// SetHardware subcommands, the first byte of the frame data
+const (
+	HW_FREQUENCY       = 0x01 // Frequency in Hz, 32-bit big endian
+	HW_LORA_PARAMETERS = 0x02 // Spreading factor, LORA_BW_xxx, LORA_CR_xxx
+)
+
+/*
+Apply a SetHardware command on top of the current frequency and LoRa parameters.
+The low data rate optimisation follows the new modulation.
+*/
+func parseSetHardware(data []byte, frequency_Hz uint32, loraParams client.LoRaParameters) (uint32, client.LoRaParameters, error) {
+	if len(data) == 0 {
+		return 0, loraParams, fmt.Errorf("empty SetHardware command")
+	}
+
+	switch data[0] {
+	case HW_FREQUENCY:
+		if len(data) != 5 {
+			return 0, loraParams, fmt.Errorf("invalid SetHardware frequency length %d", len(data))
+		}
+
+		frequency_Hz = binary.BigEndian.Uint32(data[1:5])
+
+	case HW_LORA_PARAMETERS:
+		if len(data) != 4 {
+			return 0, loraParams, fmt.Errorf("invalid SetHardware LoRa parameters length %d", len(data))
+		}
+
+		sf, bw, cr := data[1], data[2], data[3]
+
+		if sf < client.LORA_SF5 || sf > client.LORA_SF12 {
+			return 0, loraParams, fmt.Errorf("unsupported LoRa spreading factor %d", sf)
+		}
+
+		if client.BandwidthHz(bw) == 0 {
+			return 0, loraParams, fmt.Errorf("unsupported LoRa bandwidth 0x%02X", bw)
+		}
+
+		if cr < client.LORA_CR_4_5 || cr > client.LORA_CR_4_8 {
+			return 0, loraParams, fmt.Errorf("unsupported LoRa coding rate 0x%02X", cr)
+		}
+
+		loraParams = client.LoRaParameters{
+			SpreadingFactor: sf,
+			Bandwidth:       bw,
+			CodingRate:      cr,
+			LowDataRate:     client.LowDataRateRequired(sf, bw),
+		}
+
+	default:
+		return 0, loraParams, fmt.Errorf("unknown SetHardware command 0x%02X", data[0])
+	}
+
+	return frequency_Hz, loraParams, nil
+}
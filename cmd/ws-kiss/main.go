@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/meshtastic"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/pty"
+	"github.com/charmbracelet/log"
+)
+
+func usage() {
+	flag.PrintDefaults()
+}
+
+func showUsageAndExit(exitCode int) {
+	fmt.Println("Waveshare USB LoRa KISS TNC")
+	fmt.Println("Lets KISS clients transmit and receive LoRa packets over TCP or a pseudo terminal.")
+	usage()
+	os.Exit(exitCode)
+}
+
+func main() {
+	var configFile = flag.String("c", "", "Node configuration file, the radio block sets the initial channel")
+	var serialPort = flag.String("p", client.AUTO_PORT, "Serial port, 'auto' to discover the device with the configuration serial block")
+	var tcpAddress = flag.String("tcp", "", "Accept KISS clients on this TCP address, e.g. ':8001'")
+	var usePty = flag.Bool("pty", false, "Expose the TNC on a pseudo terminal")
+	var link = flag.String("link", "", "Create a symbolic link to the pseudo terminal")
+	var logLevel = flag.String("l", "info", "Log level")
+	var showHelp = flag.Bool("h", false, "Show help")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showHelp {
+		showUsageAndExit(0)
+	}
+
+	switch *logLevel {
+	case "debug":
+		log.SetLevel(log.DebugLevel)
+	case "info":
+		log.SetLevel(log.InfoLevel)
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	default:
+		log.Fatalf("Invalid log level '%s'", *logLevel)
+	}
+
+	if *configFile == "" {
+		log.Fatal("Configuration file is not specified")
+	}
+
+	if *tcpAddress == "" && !*usePty {
+		log.Fatal("Either a TCP address or a pseudo terminal is required")
+	}
+
+	config, err := meshtastic.LoadNodeConfiguration(*configFile)
+	if err != nil {
+		log.With("err", err).Fatal("Failed to load configuration")
+	}
+
+	if len(config.Radios) > 0 {
+		log.Fatal("Multiple radios are not supported, use a single radio block")
+	}
+
+	apiClient, version, err := client.OpenDevice(*serialPort, config.Serial.PortFilter())
+	if err != nil {
+		log.With("err", err).Fatal("Failed to open device")
+	}
+	defer apiClient.Close()
+
+	log.With("firmware", version.String()).Info("Device connected")
+
+	if err := configureRadio(apiClient, &config.Radio); err != nil {
+		log.Fatal(err)
+	}
+	defer apiClient.Standby(client.STANDBY_XOSC)
+
+	tnc := NewTnc(apiClient, &config.Radio)
+	if err := tnc.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if *tcpAddress != "" {
+		listener, err := net.Listen("tcp", *tcpAddress)
+		if err != nil {
+			log.With("err", err).Fatal("Failed to listen")
+		}
+		defer listener.Close()
+
+		go func() {
+			<-ctx.Done()
+			listener.Close()
+		}()
+
+		go tnc.Listen(ctx, listener)
+
+		log.With("address", listener.Addr().String()).Info("Accepting KISS clients")
+	}
+
+	if *usePty {
+		master, slave, err := pty.Open()
+		if err != nil {
+			log.With("err", err).Fatal("Failed to open pseudo terminal")
+		}
+		defer slave.Close()
+
+		if *link != "" {
+			os.Remove(*link)
+			if err := os.Symlink(slave.Name(), *link); err != nil {
+				log.With("err", err).Fatal("Failed to create symbolic link")
+			}
+			defer os.Remove(*link)
+		}
+
+		go tnc.Serve(ctx, slave.Name(), master)
+
+		log.With("port", slave.Name()).Info("KISS pseudo terminal")
+	}
+
+	if err := tnc.Run(ctx); err != nil {
+		log.With("err", err).Error("Device disconnected")
+	}
+}
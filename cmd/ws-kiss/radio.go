@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/meshtastic"
+)
+
+// Configure the radio block settings that SetHardware does not change.
+func configureRadio(apiClient *client.ApiClient, radioConfig *meshtastic.RadioConfiguration) error {
+	if _, err := apiClient.SendRequest(&client.RxTxFallbackMode{
+		FallbackMode: byte(radioConfig.FallbackMode.OrDefault()),
+	}, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set fallback mode: %v", err)
+	}
+
+	if _, err := apiClient.SendRequest(&client.RxParameters{RxBoost: radioConfig.RxBoost}, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set RX parameters: %v", err)
+	}
+
+	txParams, err := radioConfig.TxParameters()
+	if err != nil {
+		return err
+	}
+
+	if _, err := apiClient.SendRequest(txParams, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to configure TX parameters: %v", err)
+	}
+
+	packetParams := radioConfig.PacketParameters()
+	if _, err := apiClient.SendRequest(&packetParams, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set LoRa packet parameters: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/kiss"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/meshtastic"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// Largest LoRa payload
+	MAX_PACKET_LENGTH = 255
+
+	// Frames queued for a client before they get dropped
+	CLIENT_QUEUE_LENGTH = 32
+
+	BUSY_RETRY_DELAY = 500 * time.Millisecond
+)
+
+// Connected KISS client
+type kissClient struct {
+	name     string
+	conn     io.ReadWriteCloser
+	outgoing chan []byte
+}
+
+// Frame received from a client
+type clientFrame struct {
+	client *kissClient
+	frame  *kiss.Frame
+}
+
+/*
+KISS TNC on top of the device, data frames are transmitted
+and received packets are sent to every connected client.
+*/
+type Tnc struct {
+	apiClient *client.ApiClient
+	region    string
+
+	// Current channel, changed with SetHardware
+	frequency  uint32
+	loraParams client.LoRaParameters
+
+	// Fixed by the configuration, used for the time on air
+	packetParams client.LoRaPacketParameters
+
+	clientsMutex sync.Mutex
+	clients      map[*kissClient]struct{}
+
+	frames chan clientFrame
+	retry  chan struct{}
+
+	// Only used by the processing loop
+	queue        []clientFrame
+	transmitting bool
+}
+
+func NewTnc(apiClient *client.ApiClient, radioConfig *meshtastic.RadioConfiguration) *Tnc {
+	return &Tnc{
+		apiClient:    apiClient,
+		region:       radioConfig.Region,
+		frequency:    radioConfig.Frequency,
+		loraParams:   radioConfig.LoRaParameters(),
+		packetParams: radioConfig.PacketParameters(),
+		clients:      map[*kissClient]struct{}{},
+		frames:       make(chan clientFrame, 10),
+		retry:        make(chan struct{}, 1),
+	}
+}
+
+// Tune the radio to the configured channel and start receiving.
+func (t *Tnc) Start() error {
+	if err := t.apiClient.Tune(t.frequency, t.loraParams); err != nil {
+		return err
+	}
+
+	return t.apiClient.SwitchToRx(false)
+}
+
+// Serve a client until it disconnects.
+func (t *Tnc) Serve(ctx context.Context, name string, conn io.ReadWriteCloser) {
+	c := &kissClient{
+		name:     name,
+		conn:     conn,
+		outgoing: make(chan []byte, CLIENT_QUEUE_LENGTH),
+	}
+
+	t.clientsMutex.Lock()
+	t.clients[c] = struct{}{}
+	t.clientsMutex.Unlock()
+
+	log.With("client", name).Info("Client connected")
+
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case data := <-c.outgoing:
+				if _, err := conn.Write(data); err != nil {
+					log.With("client", name, "err", err).Warn("Failed to write to client")
+				}
+			}
+		}
+	}()
+
+	reader := kiss.NewReader(conn)
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			switch err.(type) {
+			case *kiss.InvalidEscapeError, *kiss.FrameTooLongError:
+				log.With("client", name, "err", err).Warn("Invalid frame")
+				continue
+			}
+
+			if err != io.EOF && ctx.Err() == nil {
+				log.With("client", name, "err", err).Warn("Failed to read from client")
+			}
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case t.frames <- clientFrame{client: c, frame: frame}:
+		}
+	}
+
+	t.clientsMutex.Lock()
+	delete(t.clients, c)
+	t.clientsMutex.Unlock()
+
+	close(done)
+	conn.Close()
+
+	log.With("client", name).Info("Client disconnected")
+}
+
+// Accept clients on a TCP listener until it is closed.
+func (t *Tnc) Listen(ctx context.Context, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.With("err", err).Error("Failed to accept client")
+			}
+			return
+		}
+
+		go t.Serve(ctx, conn.RemoteAddr().String(), conn)
+	}
+}
+
+// Process client frames and device messages, returns when the device disconnects.
+func (t *Tnc) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-t.apiClient.Disconnected:
+			return err
+		case err := <-t.apiClient.Errors:
+			log.With("err", err).Warn("Device communication error")
+		case msg := <-t.apiClient.Recv:
+			t.handleRadioMessage(msg)
+		case f := <-t.frames:
+			t.queue = append(t.queue, f)
+			t.processQueue()
+		case <-t.retry:
+			t.processQueue()
+		}
+	}
+}
+
+func (t *Tnc) handleRadioMessage(msg client.ApiMessage) {
+	if packet, ok := msg.(*client.PacketReceived); ok {
+		log.With(
+			"rssi", packet.PacketRSSI_dBm,
+			"snr", packet.PacketSNR_dB,
+			"size", len(packet.Data),
+		).Info("Received packet")
+		log.With("packet", hex.EncodeToString(packet.Data)).Debug("Received")
+
+		frame := &kiss.Frame{Command: kiss.CMD_DATA, Data: packet.Data}
+		t.broadcast(frame.Append(nil))
+
+		if !t.transmitting {
+			t.receive()
+		}
+	} else if transmitted, ok := msg.(*client.PacketTransmitted); ok {
+		log.With("timeOnAir", time.Duration(transmitted.TimeOnAir_ms)*time.Millisecond).Debug("Packet transmitted")
+		t.transmitting = false
+		t.processQueue()
+	} else if _, ok := msg.(*client.RxTxTimeout); ok {
+		log.Warn("TX timeout")
+		t.transmitting = false
+		t.processQueue()
+	}
+}
+
+// Handle the queued frames in order, one transmission at a time.
+func (t *Tnc) processQueue() {
+	for !t.transmitting && len(t.queue) > 0 {
+		f := t.queue[0]
+
+		switch f.frame.Command {
+		case kiss.CMD_DATA:
+			if !t.transmit(f.frame.Data) {
+				// Device is busy, keep the frame and try again later
+				time.AfterFunc(BUSY_RETRY_DELAY, func() {
+					select {
+					case t.retry <- struct{}{}:
+					default:
+					}
+				})
+				return
+			}
+		case kiss.CMD_SET_HARDWARE:
+			t.setHardware(f.frame.Data)
+		default:
+			// Timing parameters are meaningless for LoRa
+			log.With("client", f.client.name, "command", f.frame.Command).Debug("Ignored KISS command")
+		}
+
+		t.queue = t.queue[1:]
+	}
+
+	if !t.transmitting {
+		t.receive()
+	}
+}
+
+// Returns false when the device is busy and the packet should be sent again.
+func (t *Tnc) transmit(data []byte) bool {
+	if len(data) == 0 || len(data) > MAX_PACKET_LENGTH {
+		log.With("size", len(data)).Warn("Packet dropped, invalid size")
+		return true
+	}
+
+	timeout, err := client.TransmitTimeout(client.TimeOnAir(&t.loraParams, &t.packetParams, len(data)))
+	if err != nil {
+		log.With("size", len(data), "err", err).Warn("Packet dropped")
+		return true
+	}
+
+	res, err := t.apiClient.SendRequest(&client.Transmit{Timeout_ms: timeout, Data: data}, 5*time.Second)
+	if err != nil {
+		log.With("err", err).Error("Packet transmission failed")
+		return true
+	}
+
+	tr, ok := res.(*client.Transmit)
+	if !ok {
+		log.Error("Packet transmission failed: invalid response from device")
+		return true
+	}
+
+	if tr.Busy {
+		log.Debug("Device is busy, packet is scheduled for retransmission")
+		return false
+	}
+
+	t.transmitting = true
+
+	log.With("size", len(data)).Info("Outgoing packet")
+	log.With("packet", hex.EncodeToString(data)).Debug("Outgoing")
+
+	return true
+}
+
+func (t *Tnc) setHardware(data []byte) {
+	frequency, loraParams, err := parseSetHardware(data, t.frequency, t.loraParams)
+	if err != nil {
+		log.With("err", err).Warn("SetHardware rejected")
+		return
+	}
+
+	if t.region != "" {
+		if _, err := meshtastic.LookupBand(t.region, frequency, loraParams.Bandwidth); err != nil {
+			log.With("err", err).Warn("SetHardware rejected")
+			return
+		}
+	}
+
+	if err := t.apiClient.Tune(frequency, loraParams); err != nil {
+		log.With("err", err).Error("SetHardware failed")
+
+		// Back to the previous channel
+		if err := t.apiClient.Tune(t.frequency, t.loraParams); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	t.frequency = frequency
+	t.loraParams = loraParams
+
+	log.With(
+		"frequency", frequency,
+		"spreadingFactor", loraParams.SpreadingFactor,
+		"bandwidth", client.BandwidthHz(loraParams.Bandwidth),
+		"codingRate", loraParams.CodingRate,
+	).Info("Radio tuned")
+}
+
+func (t *Tnc) receive() {
+	if err := t.apiClient.SwitchToRx(false); err != nil {
+		log.Error(err)
+	}
+}
+
+// Send a frame to every client, slow clients miss frames rather than stall the TNC.
+func (t *Tnc) broadcast(data []byte) {
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	for c := range t.clients {
+		select {
+		case c.outgoing <- data:
+		default:
+			log.With("client", c.name).Warn("Client is too slow, frame dropped")
+		}
+	}
+}
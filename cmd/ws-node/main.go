@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
 	"github.com/Archie3d/waveshare-usb-lora-client/pkg/meshtastic"
 	"github.com/charmbracelet/log"
 )
@@ -21,9 +24,21 @@ func showUsageAndExit(exitCode int) {
 	os.Exit(exitCode)
 }
 
+// Capture file of a radio, the radio name is appended to the file name, e.g. traffic-private.jsonl
+func captureFileName(path string, radioName string) string {
+	if radioName == "" {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), radioName, ext)
+}
+
 func main() {
 	var configFile = flag.String("c", "", "Configuration file")
-	var serialPort = flag.String("p", "", "Serial port")
+	var serialPort = flag.String("p", "", "Serial port, 'auto' to discover the device (not allowed with several radios)")
+	var captureFile = flag.String("capture", "", "Record serial traffic into a capture file, with several radios one file per radio named after it")
 	var logLevel = flag.String("l", "info", "Log level")
 	var showHelp = flag.Bool("h", false, "Show help")
 
@@ -45,10 +60,6 @@ func main() {
 		log.Fatalf("Invalid log level '%s'", *logLevel)
 	}
 
-	if *serialPort == "" {
-		log.Fatal("Serial port is not specified")
-	}
-
 	if *configFile == "" {
 		log.Fatal("Configuration file is not specified")
 	}
@@ -58,39 +69,67 @@ func main() {
 		log.With("err", err).Fatal("Failed to load configuration")
 	}
 
-	node := meshtastic.NewNode(*serialPort, config)
+	// The serial ports of several radios are configured for each of them
+	if len(config.Radios) > 0 {
+		if *serialPort != "" {
+			log.Fatal("Serial port can't be given with several radios, configure the port of each radio")
+		}
+	} else if *serialPort == "" {
+		log.Fatal("Serial port is not specified")
+	}
 
-	node.AddApplication(meshtastic.NewTextApplication(config))
+	node := meshtastic.NewNode(*serialPort, config)
 
-	if config.NodeInfo != nil {
-		node.AddApplication(meshtastic.NewNodeInfoApplication(config))
+	if *captureFile != "" {
+		for _, name := range node.RadioNames() {
+			path := captureFileName(*captureFile, name)
+
+			capture, err := client.CreateCaptureFile(path)
+			if err != nil {
+				log.With("err", err).Fatal("Failed to create capture file")
+			}
+			defer func() {
+				if err := capture.Err(); err != nil {
+					log.With("err", err, "file", path).Error("Capture is incomplete")
+				}
+				capture.Close()
+			}()
+
+			if err := node.SetCapture(name, capture); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
-	if config.Telemetry != nil {
-		node.AddApplication(meshtastic.NewTelementryApplication(config))
-	}
+	if config.IsRaw() {
+		log.Info("Raw mode, Meshtastic applications are disabled")
+	} else {
+		node.AddApplication(meshtastic.NewTextApplication(config))
+
+		if config.NodeInfo != nil {
+			node.AddApplication(meshtastic.NewNodeInfoApplication(config))
+		}
 
-	if config.Position != nil {
-		node.AddApplication(meshtastic.NewPositionApplication(config))
+		if config.Telemetry != nil {
+			node.AddApplication(meshtastic.NewTelementryApplication(config))
+		}
+
+		if config.Position != nil {
+			node.AddApplication(meshtastic.NewPositionApplication(config))
+		}
 	}
 
 	if err := node.Start(); err != nil {
 		log.Fatal(err)
 	}
 
+	// Make sure we turn the radio off, before the capture files are closed
 	defer node.Stop()
 
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	go func() {
-		<-c
-		// Make sure we turn the radio off
-		node.Stop()
-		os.Exit(0)
-	}()
-
 	log.Info("Node is up an running")
 
-	select {}
+	<-c
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/charmbracelet/log"
+)
+
+func usage() {
+	flag.PrintDefaults()
+}
+
+func showUsageAndExit(exitCode int) {
+	fmt.Println("Waveshare USB LoRa spectrum survey")
+	fmt.Println("Steps the radio frequency across a range and samples the RSSI at every step.")
+	usage()
+	os.Exit(exitCode)
+}
+
+// LORA_BW_xxx value for a bandwidth in kHz (rounded down, e.g. 62 for 62.5 kHz).
+func parseBandwidth(kHz int) (byte, error) {
+	for bw := byte(0); bw <= client.LORA_BW_041; bw++ {
+		hz := client.BandwidthHz(bw)
+		if hz != 0 && int(hz/1000) == kHz {
+			return bw, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unsupported LoRa bandwidth %d kHz", kHz)
+}
+
+func main() {
+	var serialPort = flag.String("p", client.AUTO_PORT, "Serial port, 'auto' to discover the device")
+	var vid = flag.String("vid", "", "USB vendor ID used to discover the device")
+	var pid = flag.String("pid", "", "USB product ID used to discover the device")
+	var serialNumber = flag.String("serial", "", "USB serial number used to discover the device")
+	var start = flag.Uint("start", 863000000, "First frequency in Hz")
+	var stop = flag.Uint("stop", 870000000, "Last frequency in Hz")
+	var step = flag.Uint("step", 125000, "Frequency step in Hz")
+	var bandwidth = flag.Int("bw", 125, "Measurement bandwidth in kHz")
+	var samples = flag.Int("n", 10, "RSSI samples per step")
+	var interval = flag.Duration("interval", 10*time.Millisecond, "Delay between RSSI samples")
+	var settle = flag.Duration("settle", 5*time.Millisecond, "Delay after tuning before the first sample")
+	var passes = flag.Int("passes", 1, "Number of passes over the frequency range, 0 to run until interrupted")
+	var format = flag.String("format", "csv", "Output format: csv or json")
+	var outputFile = flag.String("o", "", "Output file (stdout by default)")
+	var waterfall = flag.Bool("waterfall", false, "Print an ASCII waterfall to stderr")
+	var floor = flag.Int("floor", -130, "Waterfall RSSI floor in dBm")
+	var ceiling = flag.Int("ceiling", -60, "Waterfall RSSI ceiling in dBm")
+	var logLevel = flag.String("l", "info", "Log level")
+	var showHelp = flag.Bool("h", false, "Show help")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showHelp {
+		showUsageAndExit(0)
+	}
+
+	switch *logLevel {
+	case "debug":
+		log.SetLevel(log.DebugLevel)
+	case "info":
+		log.SetLevel(log.InfoLevel)
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	default:
+		log.Fatalf("Invalid log level '%s'", *logLevel)
+	}
+
+	if *stop > math.MaxUint32 || *step > math.MaxUint32 {
+		log.Fatal("Frequencies must not exceed 4294967295 Hz")
+	}
+
+	if *start > *stop || *step == 0 {
+		log.Fatal("Invalid frequency range")
+	}
+
+	if *samples < 1 {
+		log.Fatal("At least one sample per step is required")
+	}
+
+	if *ceiling <= *floor {
+		log.Fatal("Waterfall ceiling must be above the floor")
+	}
+
+	if *format != "csv" && *format != "json" {
+		log.Fatalf("Invalid output format '%s'", *format)
+	}
+
+	bw, err := parseBandwidth(*bandwidth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		output, err = os.Create(*outputFile)
+		if err != nil {
+			log.With("err", err).Fatal("Failed to create output file")
+		}
+		defer output.Close()
+	}
+
+	var writer SampleWriter
+	if *format == "json" {
+		writer = newJsonWriter(output)
+	} else {
+		writer = newCsvWriter(output)
+	}
+
+	apiClient, version, err := client.OpenDevice(*serialPort, &client.PortFilter{Vid: *vid, Pid: *pid, SerialNumber: *serialNumber})
+	if err != nil {
+		log.With("err", err).Fatal("Failed to open device")
+	}
+	defer apiClient.Close()
+
+	log.With("firmware", version.String()).Info("Device connected")
+
+	scanner := &Scanner{
+		apiClient: apiClient,
+		samples:   *samples,
+		settle:    *settle,
+		interval:  *interval,
+	}
+
+	if err := scanner.Configure(bw); err != nil {
+		log.Fatal(err)
+	}
+	defer scanner.Standby()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	frequencies := []uint32{}
+	for f := uint64(*start); f <= uint64(*stop); f += uint64(*step) {
+		frequencies = append(frequencies, uint32(f))
+	}
+
+	if *waterfall {
+		fmt.Fprintln(os.Stderr, waterfallHeader(uint32(*start), uint32(*stop), len(frequencies)))
+	}
+
+scan:
+	for pass := 1; *passes == 0 || pass <= *passes; pass++ {
+		row := []*Sample{}
+
+		for _, f := range frequencies {
+			sample, err := scanner.Measure(ctx, f)
+			if err != nil {
+				// Keep the steps of the interrupted pass
+				writer.WritePass(row)
+				if ctx.Err() != nil {
+					break scan
+				}
+				log.With("err", err).Fatal("Scan failed")
+			}
+
+			sample.Pass = pass
+			row = append(row, sample)
+
+			log.With("frequency", f, "mean", fmt.Sprintf("%.1f", sample.Mean_dBm), "max", sample.Max_dBm).Debug("Sampled")
+		}
+
+		if err := writer.WritePass(row); err != nil {
+			log.With("err", err).Fatal("Failed to write the results")
+		}
+
+		if *waterfall {
+			fmt.Fprintln(os.Stderr, waterfallRow(row, *floor, *ceiling))
+		}
+	}
+}
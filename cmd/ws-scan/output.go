@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Waterfall characters from the quietest to the loudest
+const WATERFALL_PALETTE = " .:-=+*#%@"
+
+// Survey output, written one pass at a time so that an interrupted run keeps its results
+type SampleWriter interface {
+	WritePass(samples []*Sample) error
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func newCsvWriter(w io.Writer) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WritePass(samples []*Sample) error {
+	if !c.headerWritten {
+		if err := c.writer.Write([]string{"frequency_hz", "pass", "min_dbm", "mean_dbm", "max_dbm"}); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	for _, s := range samples {
+		err := c.writer.Write([]string{
+			strconv.FormatUint(uint64(s.Frequency_Hz), 10),
+			strconv.Itoa(s.Pass),
+			strconv.Itoa(int(s.Min_dBm)),
+			strconv.FormatFloat(s.Mean_dBm, 'f', 1, 64),
+			strconv.Itoa(int(s.Max_dBm)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.writer.Flush()
+
+	return c.writer.Error()
+}
+
+// JSON lines, one sample object per line
+type jsonWriter struct {
+	encoder *json.Encoder
+}
+
+func newJsonWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{encoder: json.NewEncoder(w)}
+}
+
+func (j *jsonWriter) WritePass(samples []*Sample) error {
+	for _, s := range samples {
+		if err := j.encoder.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Render one pass as a waterfall row, the mean RSSI of every step
+is mapped onto the palette between the floor and the ceiling.
+*/
+func waterfallRow(samples []*Sample, floor_dBm int, ceiling_dBm int) string {
+	var row strings.Builder
+
+	levels := len(WATERFALL_PALETTE) - 1
+
+	for _, s := range samples {
+		level := int((s.Mean_dBm - float64(floor_dBm)) / float64(ceiling_dBm-floor_dBm) * float64(levels))
+		level = max(0, min(level, levels))
+
+		row.WriteByte(WATERFALL_PALETTE[level])
+	}
+
+	return row.String()
+}
+
+func waterfallHeader(start_Hz uint32, stop_Hz uint32, steps int) string {
+	left := fmt.Sprintf("%.3f MHz", float64(start_Hz)/1e6)
+	right := fmt.Sprintf("%.3f MHz", float64(stop_Hz)/1e6)
+
+	padding := max(steps-len(left)-len(right), 1)
+
+	return left + strings.Repeat(" ", padding) + right
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+// RSSI statistics of a single frequency step
+type Sample struct {
+	Frequency_Hz uint32  `json:"frequency_hz"`
+	Pass         int     `json:"pass"`
+	Min_dBm      int16   `json:"min_dbm"`
+	Mean_dBm     float64 `json:"mean_dbm"`
+	Max_dBm      int16   `json:"max_dbm"`
+}
+
+type Scanner struct {
+	apiClient *client.ApiClient
+
+	// RSSI samples taken at every frequency
+	samples int
+
+	// Delay between switching to RX and the first sample
+	settle time.Duration
+
+	// Delay between samples
+	interval time.Duration
+}
+
+// Configure the modulation, the bandwidth determines the RSSI measurement bandwidth.
+func (s *Scanner) Configure(bandwidth byte) error {
+	if _, err := s.apiClient.SendRequest(&client.RxTxFallbackMode{
+		FallbackMode: client.FALLBACK_STANDBY_RC,
+	}, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set fallback mode: %v", err)
+	}
+
+	if _, err := s.apiClient.SendRequest(&client.LoRaParameters{
+		SpreadingFactor: client.LORA_SF7,
+		Bandwidth:       bandwidth,
+		CodingRate:      client.LORA_CR_4_5,
+	}, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set LoRa parameters: %v", err)
+	}
+
+	return nil
+}
+
+// Sample the RSSI at a frequency.
+func (s *Scanner) Measure(ctx context.Context, frequency_Hz uint32) (*Sample, error) {
+	// The frequency can only be changed in standby
+	if err := s.Standby(); err != nil {
+		return nil, err
+	}
+
+	if err := s.apiClient.SetFrequency(frequency_Hz); err != nil {
+		return nil, err
+	}
+
+	if err := s.apiClient.SwitchToRx(false); err != nil {
+		return nil, err
+	}
+
+	sample := &Sample{
+		Frequency_Hz: frequency_Hz,
+		Min_dBm:      math.MaxInt16,
+		Max_dBm:      math.MinInt16,
+	}
+
+	delay := s.settle
+	sum := 0.0
+
+	for i := 0; i < s.samples; i++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = s.interval
+
+		res, err := s.apiClient.SendRequest(&client.InstantaneousRSSI{}, client.REQUEST_TIMEOUT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample RSSI: %v", err)
+		}
+
+		rssi, ok := res.(*client.InstantaneousRSSI)
+		if !ok {
+			return nil, fmt.Errorf("failed to sample RSSI: invalid response from device")
+		}
+
+		sample.Min_dBm = min(sample.Min_dBm, rssi.RSSI_dBm)
+		sample.Max_dBm = max(sample.Max_dBm, rssi.RSSI_dBm)
+		sum += float64(rssi.RSSI_dBm)
+	}
+
+	sample.Mean_dBm = sum / float64(s.samples)
+
+	return sample, nil
+}
+
+func (s *Scanner) Standby() error {
+	return s.apiClient.Standby(client.STANDBY_RC)
+}
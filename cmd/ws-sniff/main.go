@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/meshtastic"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/pcap"
+	"github.com/charmbracelet/log"
+)
+
+func usage() {
+	flag.PrintDefaults()
+}
+
+func showUsageAndExit(exitCode int) {
+	fmt.Println("Waveshare USB LoRa sniffer")
+	fmt.Println("Writes every received LoRa packet into a pcap file with a LoRaTap header.")
+	usage()
+	os.Exit(exitCode)
+}
+
+// Channel keys given on the command line as name:base64key
+type channelKeys []string
+
+func (k *channelKeys) String() string {
+	return strings.Join(*k, ",")
+}
+
+func (k *channelKeys) Set(value string) error {
+	*k = append(*k, value)
+	return nil
+}
+
+func parseChannelKey(value string) (*meshtastic.Channel, error) {
+	name, encodedKey, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid channel key '%s', expected name:key", value)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel key '%s': %v", value, err)
+	}
+
+	return meshtastic.NewChannel(0, name, meshtastic.ExpandChannelKey(key)), nil
+}
+
+func main() {
+	var configFile = flag.String("c", "", "Node configuration file, the radio block sets the channel to listen to")
+	var serialPort = flag.String("p", client.AUTO_PORT, "Serial port, 'auto' to discover the device with the configuration serial block")
+	var outputFile = flag.String("o", "", "Output pcap file")
+	var decryptedFile = flag.String("d", "", "Output pcap file for decrypted packets")
+	var keys channelKeys
+	flag.Var(&keys, "k", "Channel key as name:base64key, can be repeated (the configuration channels are used too)")
+	var logLevel = flag.String("l", "info", "Log level")
+	var showHelp = flag.Bool("h", false, "Show help")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showHelp {
+		showUsageAndExit(0)
+	}
+
+	switch *logLevel {
+	case "debug":
+		log.SetLevel(log.DebugLevel)
+	case "info":
+		log.SetLevel(log.InfoLevel)
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	default:
+		log.Fatalf("Invalid log level '%s'", *logLevel)
+	}
+
+	if *configFile == "" {
+		log.Fatal("Configuration file is not specified")
+	}
+
+	if *outputFile == "" {
+		log.Fatal("Output file is not specified")
+	}
+
+	config, err := meshtastic.LoadNodeConfiguration(*configFile)
+	if err != nil {
+		log.With("err", err).Fatal("Failed to load configuration")
+	}
+
+	if len(config.Radios) > 0 {
+		log.Fatal("Multiple radios are not supported, use a single radio block")
+	}
+
+	channels := []*meshtastic.Channel{}
+
+	if *decryptedFile != "" {
+		for _, ch := range config.Channels {
+			channels = append(channels, meshtastic.NewChannel(ch.Id, ch.Name, meshtastic.ExpandChannelKey(ch.EncryptionKey)))
+		}
+
+		for _, value := range keys {
+			channel, err := parseChannelKey(value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			channels = append(channels, channel)
+		}
+	}
+
+	output, err := pcap.Create(*outputFile, pcap.LINKTYPE_LORATAP)
+	if err != nil {
+		log.With("err", err).Fatal("Failed to create output file")
+	}
+	defer output.Close()
+
+	var decrypted *pcap.Writer = nil
+	if *decryptedFile != "" {
+		decrypted, err = pcap.Create(*decryptedFile, pcap.LINKTYPE_LORATAP)
+		if err != nil {
+			log.With("err", err).Fatal("Failed to create decrypted output file")
+		}
+		defer decrypted.Close()
+	}
+
+	apiClient, version, err := client.OpenDevice(*serialPort, config.Serial.PortFilter())
+	if err != nil {
+		log.With("err", err).Fatal("Failed to open device")
+	}
+	defer apiClient.Close()
+
+	log.With("firmware", version.String()).Info("Device connected")
+
+	header := pcap.LoRaTap{
+		Frequency_Hz:    config.Radio.Frequency,
+		Bandwidth:       byte(config.Radio.Bandwidth),
+		SpreadingFactor: byte(config.Radio.SpreadingFactor),
+		SyncWord:        config.Radio.PacketParameters().SyncWord,
+	}
+
+	if err := header.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := configureRadio(apiClient, &config.Radio); err != nil {
+		log.Fatal(err)
+	}
+	defer apiClient.Standby(client.STANDBY_XOSC)
+
+	if err := apiClient.SwitchToRx(false); err != nil {
+		log.Fatal(err)
+	}
+
+	log.With("frequency", config.Radio.Frequency).Info("Sniffing")
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	packets := 0
+	buffer := []byte{}
+
+loop:
+	for {
+		select {
+		case <-c:
+			break loop
+		case err := <-apiClient.Disconnected:
+			log.With("err", err).Error("Device disconnected")
+			break loop
+		case err := <-apiClient.Errors:
+			log.With("err", err).Warn("Device communication error")
+		case msg := <-apiClient.Recv:
+			if _, ok := msg.(*client.RxTxTimeout); ok {
+				// Reception is continuous, rearm it only if the radio gave up
+				log.Warn("RX timeout")
+				if err := apiClient.SwitchToRx(false); err != nil {
+					log.Error(err)
+				}
+				continue
+			}
+
+			packet, ok := msg.(*client.PacketReceived)
+			if !ok {
+				continue
+			}
+
+			timestamp := time.Now()
+			packets++
+
+			header.PacketRssi_dBm = int(packet.PacketRSSI_dBm)
+			header.MaxRssi_dBm = int(packet.PacketRSSI_dBm)
+			header.CurrentRssi_dBm = int(packet.SignalRSSI_dBm)
+			header.Snr_dB = float64(packet.PacketSNR_dB)
+
+			log.With(
+				"rssi", packet.PacketRSSI_dBm,
+				"snr", packet.PacketSNR_dB,
+				"size", len(packet.Data),
+			).Info("Packet")
+			log.With("packet", hex.EncodeToString(packet.Data)).Debug("Received")
+
+			buffer = header.Append(buffer[:0], packet.Data)
+			if err := output.WritePacket(timestamp, buffer); err != nil {
+				log.With("err", err).Fatal("Failed to write packet")
+			}
+
+			if decrypted != nil {
+				for _, channel := range channels {
+					data, err := channel.Decrypt(packet.Data)
+					if err != nil {
+						continue
+					}
+
+					buffer = header.Append(buffer[:0], data)
+					if err := decrypted.WritePacket(timestamp, buffer); err != nil {
+						log.With("err", err).Fatal("Failed to write decrypted packet")
+					}
+					break
+				}
+			}
+		}
+	}
+
+	log.With("packets", packets).Info("Done")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/meshtastic"
+)
+
+// Tune the radio to the configured channel.
+func configureRadio(apiClient *client.ApiClient, radioConfig *meshtastic.RadioConfiguration) error {
+	if _, err := apiClient.SendRequest(&client.RxTxFallbackMode{
+		FallbackMode: client.FALLBACK_STANDBY_XOSC_RX,
+	}, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set fallback mode: %v", err)
+	}
+
+	if _, err := apiClient.SendRequest(&client.RxParameters{RxBoost: radioConfig.RxBoost}, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set RX parameters: %v", err)
+	}
+
+	packetParams := radioConfig.PacketParameters()
+	if _, err := apiClient.SendRequest(&packetParams, client.REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to set LoRa packet parameters: %v", err)
+	}
+
+	return apiClient.Tune(radioConfig.Frequency, radioConfig.LoRaParameters())
+}
@@ -38,6 +38,6 @@ require (
 
 require (
 	github.com/creack/goselect v0.1.3 // indirect
-	golang.org/x/sys v0.36.0 // indirect
+	golang.org/x/sys v0.36.0
 	google.golang.org/protobuf v1.36.9
 )
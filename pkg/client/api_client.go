@@ -3,31 +3,147 @@ package client
 import (
 	"context"
 	"fmt"
-	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
 )
 
+// Messages waiting for the Recv consumer before the oldest ones get dropped
+const MAX_QUEUED_MESSAGES = 1024
+
+// Bounded FIFO of messages waiting to be delivered to the Recv channel.
+// It lets the receiving goroutine hand over messages without ever blocking
+// on a slow consumer, the oldest messages are dropped when it is full.
+type messageQueue struct {
+	mutex    sync.Mutex
+	messages []ApiMessage
+	capacity int
+	signal   chan bool
+}
+
+func newMessageQueue(capacity int) *messageQueue {
+	return &messageQueue{
+		messages: []ApiMessage{},
+		capacity: capacity,
+		signal:   make(chan bool, 1),
+	}
+}
+
+// Returns false when the oldest message had to be dropped.
+func (q *messageQueue) push(msg ApiMessage) bool {
+	q.mutex.Lock()
+	dropped := len(q.messages) >= q.capacity
+	if dropped {
+		q.messages[0] = nil
+		q.messages = q.messages[1:]
+	}
+	q.messages = append(q.messages, msg)
+	q.mutex.Unlock()
+
+	select {
+	case q.signal <- true:
+	default:
+		// Already signalled
+	}
+
+	return !dropped
+}
+
+func (q *messageQueue) pop() ApiMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.messages) == 0 {
+		return nil
+	}
+
+	msg := q.messages[0]
+	q.messages[0] = nil
+	q.messages = q.messages[1:]
+
+	return msg
+}
+
+// Snapshot of the ApiClient counters
+type ApiClientStats struct {
+	MessagesSent      uint64 `json:"messages_sent"`
+	MessagesReceived  uint64 `json:"messages_received"`
+	CrcErrors         uint64 `json:"crc_errors"`
+	FramingErrors     uint64 `json:"framing_errors"`
+	UnknownMessages   uint64 `json:"unknown_messages"`
+	PayloadSizeErrors uint64 `json:"payload_size_errors"`
+	WriteErrors       uint64 `json:"write_errors"`
+	DroppedErrors     uint64 `json:"dropped_errors"`
+	DroppedMessages   uint64 `json:"dropped_messages"`
+	CaptureErrors     uint64 `json:"capture_errors"`
+}
+
+type apiClientCounters struct {
+	messagesSent      atomic.Uint64
+	messagesReceived  atomic.Uint64
+	crcErrors         atomic.Uint64
+	framingErrors     atomic.Uint64
+	unknownMessages   atomic.Uint64
+	payloadSizeErrors atomic.Uint64
+	writeErrors       atomic.Uint64
+	droppedErrors     atomic.Uint64
+	droppedMessages   atomic.Uint64
+	captureErrors     atomic.Uint64
+}
+
 type ApiClient struct {
 	serial *SerialClient
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 
+	// Serializes writes to the serial port
+	sendMutex sync.Mutex
+
+	// Serializes request/response exchanges with the device
+	requestMutex sync.Mutex
+
+	// Requests waiting for a response, keyed by the expected response type
+	pendingMutex sync.Mutex
+	pending      map[byte]chan ApiMessage
+
+	// Unsolicited messages (and responses nobody waits for) to be delivered to Recv,
+	// the oldest ones are dropped (and counted) when nobody reads the channel
+	queue *messageQueue
+
+	counters apiClientCounters
+
 	Send chan ApiMessage
 	Recv chan ApiMessage
+
+	// Receives an error once the serial port fails (e.g. device unplugged)
+	Disconnected chan error
+
+	// Non-fatal errors: corrupted frames, unknown messages, write failures.
+	// Errors are dropped (and counted) when nobody reads the channel.
+	Errors chan error
 }
 
 func NewApiClient() *ApiClient {
 
 	client := &ApiClient{
-		serial: NewSerialClient(),
-		ctx:    nil,
-		cancel: nil,
-		Send:   make(chan ApiMessage, 1),
-		Recv:   make(chan ApiMessage, 1),
+		serial:  NewSerialClient(),
+		ctx:     nil,
+		cancel:  nil,
+		pending: make(map[byte]chan ApiMessage),
+		queue:   newMessageQueue(MAX_QUEUED_MESSAGES),
+		Send:    make(chan ApiMessage, 1),
+		Recv:    make(chan ApiMessage, 1),
+
+		Disconnected: make(chan error, 1),
+		Errors:       make(chan error, 10),
+	}
+
+	client.serial.captureFailed = func(err error) {
+		client.counters.captureErrors.Add(1)
+		client.reportError(fmt.Errorf("capture stopped: %w", err))
 	}
 
 	return client
@@ -44,6 +160,36 @@ func (c *ApiClient) Open(portName string) error {
 		return err
 	}
 
+	c.start()
+
+	return nil
+}
+
+// Record serial traffic, see SerialClient.SetCapture.
+func (c *ApiClient) SetCapture(capture *CaptureWriter) {
+	c.serial.SetCapture(capture)
+}
+
+// Talk to the device over an already open transport.
+func (c *ApiClient) OpenTransport(port Transport) error {
+	if c.serial.IsOpen() {
+		return fmt.Errorf("serial port already open")
+	}
+
+	c.serial.OpenTransport(port)
+	c.start()
+
+	return nil
+}
+
+// Start the send, receive and delivery goroutines.
+func (c *ApiClient) start() {
+	// Forget a failure reported by the previous connection
+	select {
+	case <-c.Disconnected:
+	default:
+	}
+
 	c.ctx, c.cancel = context.WithCancel(context.Background())
 
 	// Send data to device
@@ -53,10 +199,10 @@ func (c *ApiClient) Open(portName string) error {
 			case <-c.ctx.Done():
 				return
 			case msg := <-c.Send:
-				err = c.sendMessage(msg)
+				err := c.sendMessage(msg)
 
 				if err != nil {
-					// @todo Report error
+					c.reportError(fmt.Errorf("failed to send message: %w", err))
 				}
 			}
 		}
@@ -72,27 +218,62 @@ func (c *ApiClient) Open(portName string) error {
 				msg, err := c.serial.ReceiveMessage()
 
 				if err != nil {
-					_, ok := err.(*types.TimeoutError)
-					if ok {
+					switch err.(type) {
+					case *types.TimeoutError:
 						// Timeout - keep reading
 						continue
-
+					case *CrcError:
+						c.counters.crcErrors.Add(1)
+						c.reportError(err)
+						continue
+					case *FramingError:
+						c.counters.framingErrors.Add(1)
+						c.reportError(err)
+						continue
 					}
 
 					// Failure - terminate reading loop
+					select {
+					case c.Disconnected <- err:
+					default:
+						// Already reported
+					}
 					return
 				}
 
+				c.counters.messagesReceived.Add(1)
+
 				err = c.handleMessage(msg)
 				if err != nil {
-					// Error handling message (invalid message?)
+					// Invalid message, report and keep reading
+					c.reportError(err)
 					continue
 				}
 			}
 		}
 	})
 
-	return nil
+	// Deliver queued messages to the Recv channel
+	c.wg.Go(func() {
+		for {
+			msg := c.queue.pop()
+
+			if msg == nil {
+				select {
+				case <-c.ctx.Done():
+					return
+				case <-c.queue.signal:
+					continue
+				}
+			}
+
+			select {
+			case <-c.ctx.Done():
+				return
+			case c.Recv <- msg:
+			}
+		}
+	})
 }
 
 func (c *ApiClient) Close() error {
@@ -116,89 +297,131 @@ func (c *ApiClient) Close() error {
 func (c *ApiClient) sendMessage(msg ApiMessage) error {
 	message := msg.SerializeRequest()
 
-	err := c.serial.SendMessage(&message)
+	return c.sendSerialMessage(&message)
+}
+
+func (c *ApiClient) sendSerialMessage(message *Message) error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	err := c.serial.SendMessage(message)
 	if err != nil {
+		c.counters.writeErrors.Add(1)
 		return err
 	}
 
+	c.counters.messagesSent.Add(1)
+
 	return nil
 }
 
 func (c *ApiClient) handleMessage(message *Message) error {
-	var msg ApiMessage = nil
-
-	switch message.Type {
-	case MSG_VERSION:
-		msg = &Version{}
-	case MSG_LORA_PARAMS:
-		msg = &LoRaParameters{}
-	case MSG_LORA_PACKET:
-		msg = &LoRaPacketParameters{}
-	case MSG_RX_PARAMS:
-		msg = &RxParameters{}
-	case MSG_TX_PARAMS:
-		msg = &TxParameters{}
-	case MSG_FREQUENCY:
-		msg = &RadioFrequency{}
-	case MSG_FALLBACK_MODE:
-		msg = &RxTxFallbackMode{}
-	case MSG_RSSI:
-		msg = &InstantaneousRSSI{}
-	case MSG_RX:
-		msg = &SwitchToRx{}
-	case MSG_TX:
-		msg = &Transmit{}
-	case MSG_STANDBY:
-		msg = &Standby{}
-	case MSG_TIMEOUT:
-		msg = &RxTxTimeout{}
-	case MSG_PACKET_RECEIVED:
-		msg = &PacketReceived{}
-	case MSG_PACKET_TRANSMITTED:
-		msg = &PacketTransmitted{}
-	case MSG_CONTINUOUS_RSSI:
-		msg = &ContinuoisRSSI{}
-	default:
-		return fmt.Errorf("invalid message received from device")
+	msg := newApiMessage(message.Type)
+	if msg == nil {
+		c.counters.unknownMessages.Add(1)
+		return &UnknownMessageError{Type: message.Type}
 	}
 
 	if err := msg.DeserializeResponse(message); err != nil {
-		return nil
+		if _, ok := err.(*MessagePayloadSizeError); ok {
+			c.counters.payloadSizeErrors.Add(1)
+		}
+		return fmt.Errorf("failed to deserialize message 0x%02X: %w", message.Type, err)
 	}
 
-	if msg != nil {
-		c.Recv <- msg
-	}
+	c.dispatch(message.Type, msg)
 
 	return nil
 }
 
+// Route a message received from the device either to the pending request
+// waiting for it or to the Recv channel. Unsolicited messages are never
+// consumed by requests.
+func (c *ApiClient) dispatch(messageType byte, msg ApiMessage) {
+	if !isUnsolicited(messageType) {
+		c.pendingMutex.Lock()
+		response, ok := c.pending[messageType]
+		if ok {
+			delete(c.pending, messageType)
+		}
+		c.pendingMutex.Unlock()
+
+		if ok {
+			// The channel is buffered and owned by a single request
+			response <- msg
+			return
+		}
+	}
+
+	// Unsolicited message or a response nobody is waiting for
+	if !c.queue.push(msg) {
+		c.counters.droppedMessages.Add(1)
+	}
+}
+
+// Report a non-fatal error without blocking the caller.
+func (c *ApiClient) reportError(err error) {
+	select {
+	case c.Errors <- err:
+	default:
+		c.counters.droppedErrors.Add(1)
+	}
+}
+
+// Snapshot of the client counters.
+func (c *ApiClient) Stats() ApiClientStats {
+	return ApiClientStats{
+		MessagesSent:      c.counters.messagesSent.Load(),
+		MessagesReceived:  c.counters.messagesReceived.Load(),
+		CrcErrors:         c.counters.crcErrors.Load(),
+		FramingErrors:     c.counters.framingErrors.Load(),
+		UnknownMessages:   c.counters.unknownMessages.Load(),
+		PayloadSizeErrors: c.counters.payloadSizeErrors.Load(),
+		WriteErrors:       c.counters.writeErrors.Load(),
+		DroppedErrors:     c.counters.droppedErrors.Load(),
+		DroppedMessages:   c.counters.droppedMessages.Load(),
+		CaptureErrors:     c.counters.captureErrors.Load(),
+	}
+}
+
 func (c *ApiClient) SendMessage(msg ApiMessage) {
 	c.Send <- msg
 }
 
+/*
+Send a request to the device and wait for its response.
+Concurrent requests are serialized, unsolicited messages received while
+waiting are delivered to the Recv channel as usual.
+*/
 func (c *ApiClient) SendRequest(msg ApiMessage, timeout time.Duration) (ApiMessage, error) {
-	err := c.sendMessage(msg)
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+
+	request := msg.SerializeRequest()
+	expectedType := responseType(request.Type)
+
+	response := make(chan ApiMessage, 1)
+
+	c.pendingMutex.Lock()
+	c.pending[expectedType] = response
+	c.pendingMutex.Unlock()
+
+	defer func() {
+		c.pendingMutex.Lock()
+		delete(c.pending, expectedType)
+		c.pendingMutex.Unlock()
+	}()
+
+	err := c.sendSerialMessage(&request)
 	if err != nil {
 		return nil, err
 	}
 
-	start := time.Now()
-
-	for {
-		elapsed := time.Since(start)
-		if elapsed >= timeout {
-			return nil, &types.TimeoutError{}
-		}
-
-		select {
-		case res := <-c.Recv:
-			if reflect.TypeOf(res) == reflect.TypeOf(msg) {
-				return res, nil
-			}
-		case <-time.After(timeout - elapsed):
-			return nil, &types.TimeoutError{}
-		}
+	select {
+	case res := <-response:
+		return res, nil
+	case <-time.After(timeout):
+		return nil, &types.TimeoutError{}
 	}
 }
 
@@ -210,3 +433,18 @@ func (c *ApiClient) ReceiveMessage(timeout time.Duration) (ApiMessage, error) {
 		return nil, &types.TimeoutError{}
 	}
 }
+
+// Query the firmware version, a device answering it speaks the client protocol.
+func (c *ApiClient) CheckFirmware(timeout time.Duration) (Version, error) {
+	res, err := c.SendRequest(&Version{}, timeout)
+	if err != nil {
+		return Version{}, err
+	}
+
+	version, ok := res.(*Version)
+	if !ok {
+		return Version{}, fmt.Errorf("invalid response from device")
+	}
+
+	return *version, nil
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestKeepsUnsolicitedMessages(t *testing.T) {
+	a, b := NewPipeTransport()
+
+	apiClient := NewApiClient()
+	assert.NoError(t, apiClient.OpenTransport(a))
+	defer apiClient.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	go func() {
+		request, err := device.ReceiveMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, byte(MSG_GET_VERSION), request.Type)
+
+		// Unsolicited messages arriving before the response
+		rssi := (&ContinuoisRSSI{RSSI_dBm: -97}).SerializeRequest()
+		device.SendMessage(&rssi)
+
+		packet := Message{Type: MSG_PACKET_RECEIVED, Payload: []byte{0xA0, 0x05, 0xA5, 0x01, 0x02}}
+		device.SendMessage(&packet)
+
+		device.SendMessage(&Message{Type: MSG_VERSION, Payload: []byte{1, 2, 3}})
+	}()
+
+	res, err := apiClient.SendRequest(&Version{}, time.Second)
+	assert.NoError(t, err)
+
+	version, ok := res.(*Version)
+	assert.True(t, ok)
+	assert.Equal(t, Version{Major: 1, Minor: 2, Patch: 3}, *version)
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &ContinuoisRSSI{RSSI_dBm: -97}, msg)
+
+	msg, err = apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &PacketReceived{}, msg)
+	assert.Equal(t, []byte{0x01, 0x02}, msg.(*PacketReceived).Data)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	a, b := NewPipeTransport()
+
+	apiClient := NewApiClient()
+	assert.NoError(t, apiClient.OpenTransport(a))
+	defer apiClient.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	go device.ReceiveMessage()
+
+	_, err := apiClient.SendRequest(&Version{}, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestErrorsAndStats(t *testing.T) {
+	a, b := NewPipeTransport()
+
+	apiClient := NewApiClient()
+	assert.NoError(t, apiClient.OpenTransport(a))
+	defer apiClient.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	go func() {
+		// Corrupted CRC
+		b.Write([]byte{START, MSG_TIMEOUT, 0x00, 0x00, 0x12, 0x34})
+
+		// Invalid escape sequence
+		b.Write([]byte{START, MSG_TIMEOUT, ESCAPE, 0x00})
+
+		// Unknown message type
+		device.SendMessage(&Message{Type: 0x9E, Payload: []byte{}})
+
+		// Invalid payload size
+		device.SendMessage(&Message{Type: MSG_CONTINUOUS_RSSI, Payload: []byte{0x01}})
+
+		device.SendMessage(&Message{Type: MSG_TIMEOUT, Payload: []byte{}})
+	}()
+
+	// Reception continues after errors
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &RxTxTimeout{}, msg)
+
+	assert.IsType(t, &CrcError{}, <-apiClient.Errors)
+	assert.IsType(t, &FramingError{}, <-apiClient.Errors)
+	assert.IsType(t, &UnknownMessageError{}, <-apiClient.Errors)
+	var payloadSizeError *MessagePayloadSizeError
+	assert.ErrorAs(t, <-apiClient.Errors, &payloadSizeError)
+
+	stats := apiClient.Stats()
+	assert.Equal(t, uint64(1), stats.CrcErrors)
+	assert.Equal(t, uint64(1), stats.FramingErrors)
+	assert.Equal(t, uint64(1), stats.UnknownMessages)
+	assert.Equal(t, uint64(1), stats.PayloadSizeErrors)
+	assert.Equal(t, uint64(3), stats.MessagesReceived)
+}
+
+func TestDispatch(t *testing.T) {
+	apiClient := NewApiClient()
+
+	response := make(chan ApiMessage, 1)
+	apiClient.pending[MSG_VERSION] = response
+
+	// Response to a pending request
+	apiClient.dispatch(MSG_VERSION, &Version{Major: 1})
+	assert.Equal(t, &Version{Major: 1}, <-response)
+	assert.NotContains(t, apiClient.pending, byte(MSG_VERSION))
+
+	// Response nobody is waiting for
+	apiClient.dispatch(MSG_VERSION, &Version{Major: 2})
+
+	// Unsolicited messages are never consumed by requests
+	apiClient.pending[MSG_TIMEOUT] = response
+	apiClient.dispatch(MSG_TIMEOUT, &RxTxTimeout{})
+	assert.Empty(t, response)
+
+	assert.Equal(t, &Version{Major: 2}, apiClient.queue.pop())
+	assert.Equal(t, &RxTxTimeout{}, apiClient.queue.pop())
+	assert.Nil(t, apiClient.queue.pop())
+}
+
+func TestQueueDropsOldestMessages(t *testing.T) {
+	apiClient := NewApiClient()
+
+	for i := 0; i <= MAX_QUEUED_MESSAGES; i++ {
+		apiClient.dispatch(MSG_CONTINUOUS_RSSI, &ContinuoisRSSI{RSSI_dBm: int16(i)})
+	}
+
+	assert.Equal(t, uint64(1), apiClient.Stats().DroppedMessages)
+	assert.Equal(t, &ContinuoisRSSI{RSSI_dBm: 1}, apiClient.queue.pop())
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	CAPTURE_RX = "rx" // Frame received from the device
+	CAPTURE_TX = "tx" // Frame sent to the device
+
+	REPLAY_PREFIX = "replay://"
+)
+
+// Single frame recorded in a capture file (one JSON object per line).
+type CaptureRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Direction string    `json:"direction"`
+	Type      byte      `json:"type"`
+	Payload   []byte    `json:"payload"`
+}
+
+type CaptureWriter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+
+	// First write error, recording stops there
+	err error
+}
+
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Create (or truncate) a capture file.
+func CreateCaptureFile(path string) (*CaptureWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := NewCaptureWriter(f)
+	writer.closer = f
+
+	return writer, nil
+}
+
+/*
+Record a frame sent or received. Recording stops at the first error
+(e.g. a full disk), which is only returned once and is kept by Err.
+*/
+func (w *CaptureWriter) Write(direction string, message *Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.err != nil {
+		return nil
+	}
+
+	w.err = w.encoder.Encode(&CaptureRecord{
+		Timestamp: time.Now(),
+		Direction: direction,
+		Type:      message.Type,
+		Payload:   message.Payload,
+	})
+
+	return w.err
+}
+
+// Error that stopped the recording, nil when the capture is complete.
+func (w *CaptureWriter) Err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.err
+}
+
+func (w *CaptureWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closer == nil {
+		return nil
+	}
+
+	return w.closer.Close()
+}
+
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	records := []CaptureRecord{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid capture record at line %d: %w", line, err)
+		}
+
+		if record.Direction != CAPTURE_RX && record.Direction != CAPTURE_TX {
+			return nil, fmt.Errorf("invalid capture direction '%s' at line %d", record.Direction, line)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+func ReadCaptureFile(path string) ([]CaptureRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadCapture(f)
+}
+
+//------------------------------------------------------------------------------
+
+/*
+Transport that plays back the frames received from the device in a capture.
+Received frames that followed a frame sent to the device in the capture are
+held back until the host writes something, so that request/response
+exchanges are replayed in the original order. Read returns io.EOF once the
+whole capture has been played back.
+*/
+type replayTransport struct {
+	mutex   sync.Mutex
+	records []CaptureRecord
+	index   int
+	pending []byte
+	writes  int
+	written chan bool
+	closed  bool
+}
+
+func NewReplayTransport(records []CaptureRecord) Transport {
+	return &replayTransport{
+		records: records,
+		written: make(chan bool, 1),
+	}
+}
+
+// Open a capture file for replay.
+func NewReplayFileTransport(path string) (Transport, error) {
+	records, err := ReadCaptureFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayTransport(records), nil
+}
+
+func (t *replayTransport) Read(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for {
+		if t.closed {
+			return 0, os.ErrClosed
+		}
+
+		if len(t.pending) > 0 {
+			n := copy(p, t.pending)
+			t.pending = t.pending[n:]
+			return n, nil
+		}
+
+		if t.index >= len(t.records) {
+			return 0, io.EOF
+		}
+
+		record := &t.records[t.index]
+
+		if record.Direction == CAPTURE_TX {
+			if t.writes == 0 {
+				// Wait for the host to send its frame
+				t.mutex.Unlock()
+				select {
+				case <-t.written:
+				case <-time.After(DEFAULT_READ_TIMEOUT):
+				}
+				t.mutex.Lock()
+
+				if t.writes == 0 {
+					return 0, nil
+				}
+			}
+
+			t.writes--
+			t.index++
+			continue
+		}
+
+		t.pending = encodeFrame(nil, &Message{Type: record.Type, Payload: record.Payload})
+		t.index++
+	}
+}
+
+func (t *replayTransport) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return 0, os.ErrClosed
+	}
+
+	t.writes++
+
+	select {
+	case t.written <- true:
+	default:
+	}
+
+	return len(p), nil
+}
+
+func (t *replayTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.closed = true
+	return nil
+}
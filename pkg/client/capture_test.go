@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureAndReplay(t *testing.T) {
+	var buffer bytes.Buffer
+
+	a, b := NewPipeTransport()
+
+	apiClient := NewApiClient()
+	apiClient.SetCapture(NewCaptureWriter(&buffer))
+	assert.NoError(t, apiClient.OpenTransport(a))
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+
+	go func() {
+		device.SendMessage(&Message{Type: MSG_CONTINUOUS_RSSI, Payload: []byte{0xA0, 0xFF}})
+
+		request, err := device.ReceiveMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, byte(MSG_GET_VERSION), request.Type)
+
+		device.SendMessage(&Message{Type: MSG_VERSION, Payload: []byte{1, 2, 3}})
+		device.SendMessage(&Message{Type: MSG_PACKET_RECEIVED, Payload: []byte{0xB0, 0x05, 0xA0, START, ESCAPE}})
+	}()
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &ContinuoisRSSI{}, msg)
+
+	_, err = apiClient.SendRequest(&Version{}, time.Second)
+	assert.NoError(t, err)
+
+	msg, err = apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &PacketReceived{}, msg)
+
+	apiClient.Close()
+	device.Close()
+
+	records, err := ReadCapture(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, CAPTURE_RX, records[0].Direction)
+	assert.Equal(t, CAPTURE_TX, records[1].Direction)
+	assert.Equal(t, byte(MSG_GET_VERSION), records[1].Type)
+
+	// Replay
+	replayClient := NewApiClient()
+	assert.NoError(t, replayClient.OpenTransport(NewReplayTransport(records)))
+	defer replayClient.Close()
+
+	msg, err = replayClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &ContinuoisRSSI{RSSI_dBm: -96}, msg)
+
+	res, err := replayClient.SendRequest(&Version{}, 2*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &Version{Major: 1, Minor: 2, Patch: 3}, res)
+
+	msg, err = replayClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{START, ESCAPE}, msg.(*PacketReceived).Data)
+
+	// End of capture
+	assert.Error(t, <-replayClient.Disconnected)
+}
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestCaptureWriteError(t *testing.T) {
+	a, b := NewPipeTransport()
+
+	capture := NewCaptureWriter(failingWriter{})
+
+	apiClient := NewApiClient()
+	apiClient.SetCapture(capture)
+	assert.NoError(t, apiClient.OpenTransport(a))
+	defer apiClient.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	go func() {
+		device.SendMessage(&Message{Type: MSG_TIMEOUT, Payload: []byte{}})
+		device.SendMessage(&Message{Type: MSG_TIMEOUT, Payload: []byte{}})
+	}()
+
+	for range 2 {
+		_, err := apiClient.ReceiveMessage(time.Second)
+		assert.NoError(t, err)
+	}
+
+	// Reported once, recording stops
+	assert.ErrorIs(t, <-apiClient.Errors, os.ErrClosed)
+	assert.Empty(t, apiClient.Errors)
+	assert.ErrorIs(t, capture.Err(), os.ErrClosed)
+	assert.Equal(t, uint64(1), apiClient.Stats().CaptureErrors)
+}
@@ -0,0 +1,174 @@
+package client
+
+import "fmt"
+
+type decoderState int
+
+const (
+	stateStart decoderState = iota
+	stateType
+	stateLengthLsb
+	stateLengthMsb
+	statePayload
+	stateCrcLsb
+	stateCrcMsb
+)
+
+/*
+Streaming decoder of the serial protocol frames:
+
+	START | type | length (LE16) | payload | CRC16 (LE16)
+
+with START and ESCAPE bytes escaped after the START byte.
+A START byte received in the middle of a frame discards the partial
+frame and starts decoding a new one.
+
+The decoded message payload is stored in a buffer reused between frames.
+*/
+type frameDecoder struct {
+	state    decoderState
+	escaped  bool
+	crc      uint16
+	length   uint16
+	received uint16
+	crcLsb   byte
+	buffer   []byte
+	message  Message
+}
+
+func (d *frameDecoder) restart() {
+	d.state = stateType
+	d.escaped = false
+	d.crc = 0
+}
+
+/*
+Feed a single raw byte received from the device.
+Returns true once a complete frame has been decoded,
+the message is then available via d.message.
+*/
+func (d *frameDecoder) feed(b byte) (bool, error) {
+	if b == START {
+		interrupted := d.state != stateStart
+		d.restart()
+
+		if interrupted {
+			return false, &FramingError{Reason: "frame interrupted by a new frame"}
+		}
+
+		return false, nil
+	}
+
+	if d.state == stateStart {
+		// Noise between frames
+		return false, nil
+	}
+
+	if d.escaped {
+		d.escaped = false
+
+		switch b {
+		case ESCAPE_START:
+			b = START
+		case ESCAPE_ESCAPE:
+			b = ESCAPE
+		default:
+			d.state = stateStart
+			return false, &FramingError{Reason: fmt.Sprintf("invalid escape sequence 0x%02X", b)}
+		}
+	} else if b == ESCAPE {
+		d.escaped = true
+		return false, nil
+	}
+
+	switch d.state {
+	case stateType:
+		d.message.Type = b
+		d.crc = crc16Update(d.crc, b)
+		d.state = stateLengthLsb
+	case stateLengthLsb:
+		d.length = uint16(b)
+		d.crc = crc16Update(d.crc, b)
+		d.state = stateLengthMsb
+	case stateLengthMsb:
+		d.length |= uint16(b) << 8
+		d.crc = crc16Update(d.crc, b)
+		d.received = 0
+
+		if int(d.length) > cap(d.buffer) {
+			d.buffer = make([]byte, d.length)
+		}
+		d.message.Payload = d.buffer[:d.length]
+
+		if d.length == 0 {
+			d.state = stateCrcLsb
+		} else {
+			d.state = statePayload
+		}
+	case statePayload:
+		d.message.Payload[d.received] = b
+		d.received++
+		d.crc = crc16Update(d.crc, b)
+
+		if d.received == d.length {
+			d.state = stateCrcLsb
+		}
+	case stateCrcLsb:
+		d.crcLsb = b
+		d.state = stateCrcMsb
+	case stateCrcMsb:
+		d.state = stateStart
+
+		crc := uint16(b)<<8 | uint16(d.crcLsb)
+		if crc != d.crc {
+			return false, &CrcError{Calculated: d.crc, Received: crc}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Append escaped data to dst.
+func appendEscaped(dst []byte, data []byte) []byte {
+	for _, b := range data {
+		switch b {
+		case START:
+			dst = append(dst, ESCAPE, ESCAPE_START)
+		case ESCAPE:
+			dst = append(dst, ESCAPE, ESCAPE_ESCAPE)
+		default:
+			dst = append(dst, b)
+		}
+	}
+
+	return dst
+}
+
+/*
+Encode a message into a frame, reusing the buffer if it is large enough.
+*/
+func encodeFrame(buffer []byte, message *Message) []byte {
+	payloadLength := len(message.Payload)
+
+	// Worst case, when every byte after START has to be escaped
+	size := 1 + 2*(5+payloadLength)
+	if cap(buffer) < size {
+		buffer = make([]byte, 0, size)
+	}
+
+	header := [3]byte{message.Type, byte(payloadLength & 0xFF), byte(payloadLength >> 8)}
+
+	crc := crc16(0, header[:])
+	crc = crc16(crc, message.Payload)
+
+	trailer := [2]byte{byte(crc & 0xFF), byte(crc >> 8)}
+
+	frame := append(buffer[:0], START)
+	frame = appendEscaped(frame, header[:])
+	frame = appendEscaped(frame, message.Payload)
+	frame = appendEscaped(frame, trailer[:])
+
+	return frame
+}
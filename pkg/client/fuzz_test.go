@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Transport reading from a fixed buffer, io.EOF once it is exhausted.
+type bufferTransport struct {
+	reader *bytes.Reader
+	writer bytes.Buffer
+}
+
+func newBufferTransport(data []byte) *bufferTransport {
+	return &bufferTransport{reader: bytes.NewReader(data)}
+}
+
+func (t *bufferTransport) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *bufferTransport) Write(p []byte) (int, error) {
+	return t.writer.Write(p)
+}
+
+func (t *bufferTransport) Close() error {
+	return nil
+}
+
+// Decode every message in the data, skipping the malformed frames.
+func receiveAll(t *testing.T, data []byte) []Message {
+	c := NewSerialClient()
+	c.OpenTransport(newBufferTransport(data))
+
+	messages := []Message{}
+
+	for {
+		message, err := c.ReceiveMessage()
+		if errors.Is(err, io.EOF) {
+			return messages
+		}
+
+		if err != nil {
+			var crcError *CrcError
+			var framingError *FramingError
+			if !errors.As(err, &crcError) && !errors.As(err, &framingError) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			continue
+		}
+
+		messages = append(messages, Message{
+			Type:    message.Type,
+			Payload: bytes.Clone(message.Payload),
+		})
+	}
+}
+
+func FuzzReceiveMessage(f *testing.F) {
+	packet := Message{Type: MSG_PACKET_RECEIVED, Payload: []byte{0xA0, 0x05, 0xA5, START, ESCAPE, 0x01}}
+	version := Message{Type: MSG_VERSION, Payload: []byte{1, 2, 3}}
+
+	f.Add(encodeFrame(nil, &packet))
+	f.Add(append(encodeFrame(nil, &version), encodeFrame(nil, &packet)...))
+	f.Add([]byte{START, MSG_VERSION, 0x03, 0x00, 0x01, 0x02, 0x03, 0x00, 0x00})
+	f.Add([]byte{START, MSG_LOGGING, 0xFF, 0xFF, ESCAPE, 0x00})
+	f.Add([]byte{0x00, START, START, ESCAPE, ESCAPE})
+	// Empty payload after a longer frame, decoded as an empty slice instead of nil
+	f.Add([]byte("\xaa\x00*\x00\x00\x00\x00\x00\x81\xaa\x00\x00\x00\x00\x00\x00"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		messages := receiveAll(t, data)
+
+		// Whatever was decoded survives a round trip unchanged
+		var frames []byte
+		for i := range messages {
+			frames = append(frames, encodeFrame(nil, &messages[i])...)
+		}
+
+		decoded := receiveAll(t, frames)
+		assert.Equal(t, len(messages), len(decoded))
+
+		for i := range decoded {
+			assert.Equal(t, messages[i].Type, decoded[i].Type)
+			assert.True(t, bytes.Equal(messages[i].Payload, decoded[i].Payload), "payload %x decoded as %x", messages[i].Payload, decoded[i].Payload)
+		}
+	})
+}
+
+func FuzzDeserializeResponse(f *testing.F) {
+	f.Add(byte(MSG_VERSION), []byte{1, 2, 3})
+	f.Add(byte(MSG_PACKET_RECEIVED), []byte{0xA0, 0x05, 0xA5, 0x01, 0x02})
+	f.Add(byte(MSG_PACKET_RECEIVED), []byte{})
+	f.Add(byte(MSG_LOGGING), []byte{LOG_INFO, 'o', 'k'})
+	f.Add(byte(MSG_CONTINUOUS_RSSI), []byte{0x9F})
+
+	f.Fuzz(func(t *testing.T, messageType byte, payload []byte) {
+		msg := newApiMessage(messageType)
+		if msg == nil {
+			return
+		}
+
+		// Only the payload size can be wrong for a message of a matching type
+		err := msg.DeserializeResponse(&Message{Type: messageType, Payload: payload})
+		if err != nil {
+			assert.IsType(t, &MessagePayloadSizeError{}, err)
+		}
+
+		// Messages of any other type are rejected
+		for otherType := 0; otherType <= 0xFF; otherType++ {
+			if byte(otherType) == messageType {
+				continue
+			}
+
+			err := newApiMessage(messageType).DeserializeResponse(&Message{Type: byte(otherType), Payload: payload})
+			assert.IsType(t, &MessageTypeError{}, err)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Symbol duration above which the low data rate optimisation is required
+const LDRO_SYMBOL_DURATION = 16 * time.Millisecond
+
+const (
+	// Added to the time on air, so that the transmission doesn't time out on the device
+	TX_TIMEOUT_MARGIN = 500 * time.Millisecond
+
+	// Longest TX timeout of the radio: 24 bits in 15.625 us steps
+	MAX_TX_TIMEOUT = 262143 * time.Millisecond
+)
+
+// Frequency range of the SX1262 radio
+const (
+	MIN_FREQUENCY_HZ = 150000000
+	MAX_FREQUENCY_HZ = 960000000
+)
+
+// Check that the radio can be tuned to the frequency.
+func CheckFrequency(frequency_Hz uint32) error {
+	if frequency_Hz < MIN_FREQUENCY_HZ || frequency_Hz > MAX_FREQUENCY_HZ {
+		return fmt.Errorf("frequency %d Hz is outside of the %d-%d MHz range of the radio",
+			frequency_Hz, MIN_FREQUENCY_HZ/1000000, MAX_FREQUENCY_HZ/1000000)
+	}
+
+	return nil
+}
+
+type AirtimeTooLongError struct {
+	TimeOnAir time.Duration
+}
+
+func (e *AirtimeTooLongError) Error() string {
+	return fmt.Sprintf("time on air %v exceeds the device TX timeout limit of %v", e.TimeOnAir, MAX_TX_TIMEOUT-TX_TIMEOUT_MARGIN)
+}
+
+// Transmit.Timeout_ms for a packet with the given time on air.
+func TransmitTimeout(timeOnAir time.Duration) (uint32, error) {
+	timeout := timeOnAir + TX_TIMEOUT_MARGIN
+	if timeout > MAX_TX_TIMEOUT {
+		return 0, &AirtimeTooLongError{TimeOnAir: timeOnAir}
+	}
+
+	return uint32(timeout.Milliseconds()), nil
+}
+
+// Bandwidth in Hz for a LORA_BW_xxx value, 0 for unknown values.
+func BandwidthHz(bandwidth byte) uint32 {
+	switch bandwidth {
+	case LORA_BW_500:
+		return 500000
+	case LORA_BW_250:
+		return 250000
+	case LORA_BW_125:
+		return 125000
+	case LORA_BW_062:
+		return 62500
+	case LORA_BW_041:
+		return 41670
+	case LORA_BW_031:
+		return 31250
+	case LORA_BW_020:
+		return 20830
+	case LORA_BW_015:
+		return 15630
+	case LORA_BW_010:
+		return 10420
+	case LORA_BW_007:
+		return 7810
+	}
+
+	return 0
+}
+
+// Duration of a single LoRa symbol, 2^SF / BW.
+func SymbolDuration(spreadingFactor byte, bandwidth byte) time.Duration {
+	bw := BandwidthHz(bandwidth)
+	if bw == 0 {
+		return 0
+	}
+
+	return time.Duration(float64(uint32(1)<<spreadingFactor) / float64(bw) * float64(time.Second))
+}
+
+// Whether the modulation needs the low data rate optimisation (long symbols).
+func LowDataRateRequired(spreadingFactor byte, bandwidth byte) bool {
+	return SymbolDuration(spreadingFactor, bandwidth) > LDRO_SYMBOL_DURATION
+}
+
+/*
+Time on air of a LoRa packet carrying payloadLength bytes.
+See SX1261/2 datasheet, section 6.1.4 "LoRa Time-on-Air".
+*/
+func TimeOnAir(loraParams *LoRaParameters, packetParams *LoRaPacketParameters, payloadLength int) time.Duration {
+	sf := int(loraParams.SpreadingFactor)
+	cr := int(loraParams.CodingRate)
+
+	crcBits := 0
+	if packetParams.CrcOn {
+		crcBits = 16
+	}
+
+	headerSymbols := 20
+	if packetParams.ImplicitHeader {
+		headerSymbols = 0
+	}
+
+	var symbols float64
+
+	if sf < LORA_SF7 {
+		bits := max(8*payloadLength+crcBits-4*sf+headerSymbols, 0)
+		symbols = float64(packetParams.PreambleLength) + 6.25 + 8 +
+			math.Ceil(float64(bits)/float64(4*sf))*float64(cr+4)
+	} else {
+		bitsPerSymbol := 4 * sf
+		if loraParams.LowDataRate {
+			bitsPerSymbol = 4 * (sf - 2)
+		}
+
+		bits := max(8*payloadLength+crcBits-4*sf+8+headerSymbols, 0)
+		symbols = float64(packetParams.PreambleLength) + 4.25 + 8 +
+			math.Ceil(float64(bits)/float64(bitsPerSymbol))*float64(cr+4)
+	}
+
+	return time.Duration(symbols * float64(SymbolDuration(loraParams.SpreadingFactor, loraParams.Bandwidth)))
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymbolDuration(t *testing.T) {
+	assert.Equal(t, 1024*time.Microsecond, SymbolDuration(LORA_SF7, LORA_BW_125))
+	assert.Equal(t, 8192*time.Microsecond, SymbolDuration(LORA_SF11, LORA_BW_250))
+	assert.Equal(t, 32768*time.Microsecond, SymbolDuration(LORA_SF12, LORA_BW_125))
+}
+
+func TestLowDataRateRequired(t *testing.T) {
+	assert.False(t, LowDataRateRequired(LORA_SF11, LORA_BW_250))
+	assert.False(t, LowDataRateRequired(LORA_SF10, LORA_BW_125))
+	assert.True(t, LowDataRateRequired(LORA_SF11, LORA_BW_125))
+	assert.True(t, LowDataRateRequired(LORA_SF12, LORA_BW_125))
+	assert.True(t, LowDataRateRequired(LORA_SF9, LORA_BW_031))
+}
+
+func TestTimeOnAir(t *testing.T) {
+	packetParams := &LoRaPacketParameters{
+		PreambleLength: 16,
+		SyncWord:       0x2B,
+		CrcOn:          true,
+	}
+
+	// Meshtastic LongFast
+	loraParams := &LoRaParameters{
+		SpreadingFactor: LORA_SF11,
+		Bandwidth:       LORA_BW_250,
+		CodingRate:      LORA_CR_4_5,
+	}
+
+	// 16 + 4.25 + 8 + ceil((8*50 + 16 - 44 + 8 + 20) / 44) * 5 = 78.25 symbols
+	assert.Equal(t, time.Duration(78.25*8192)*time.Microsecond, TimeOnAir(loraParams, packetParams, 50))
+
+	// Low data rate optimisation
+	loraParams = &LoRaParameters{
+		SpreadingFactor: LORA_SF12,
+		Bandwidth:       LORA_BW_125,
+		CodingRate:      LORA_CR_4_8,
+		LowDataRate:     true,
+	}
+
+	// 16 + 4.25 + 8 + ceil((8*10 + 16 - 48 + 8 + 20) / 40) * 8 = 44.25 symbols
+	assert.Equal(t, time.Duration(44.25*32768)*time.Microsecond, TimeOnAir(loraParams, packetParams, 10))
+}
+
+func TestCheckFrequency(t *testing.T) {
+	assert.NoError(t, CheckFrequency(869525000))
+	assert.NoError(t, CheckFrequency(MIN_FREQUENCY_HZ))
+	assert.NoError(t, CheckFrequency(MAX_FREQUENCY_HZ))
+	assert.Error(t, CheckFrequency(0))
+	assert.Error(t, CheckFrequency(2400000000))
+}
+
+func TestTransmitTimeout(t *testing.T) {
+	timeout, err := TransmitTimeout(1500 * time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2000), timeout)
+
+	_, err = TransmitTimeout(MAX_TX_TIMEOUT)
+	assert.IsType(t, &AirtimeTooLongError{}, err)
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 const (
@@ -100,6 +101,24 @@ const (
 	STANDBY_XOSC = 0x01
 )
 
+// Device log levels
+const (
+	LOG_DEBUG   = 0x00
+	LOG_INFO    = 0x01
+	LOG_WARNING = 0x02
+	LOG_ERROR   = 0x03
+)
+
+// Response message type sent by the device for a given request type
+func responseType(requestType byte) byte {
+	return requestType | 0x80
+}
+
+// Whether the message type is an unsolicited message from the device
+func isUnsolicited(messageType byte) bool {
+	return messageType >= MSG_TIMEOUT && messageType <= MSG_LOGGING
+}
+
 type ApiMessage interface {
 	SerializeRequest() Message
 	DeserializeResponse(msg *Message) error
@@ -129,6 +148,54 @@ func (e *MessagePayloadSizeError) Error() string {
 	return "invalid message payload size"
 }
 
+type UnknownMessageError struct {
+	Type byte
+}
+
+func (e *UnknownMessageError) Error() string {
+	return fmt.Sprintf("unknown message type 0x%02X received from device", e.Type)
+}
+
+// Empty message of a type the device sends, nil for unknown types.
+func newApiMessage(messageType byte) ApiMessage {
+	switch messageType {
+	case MSG_VERSION:
+		return &Version{}
+	case MSG_LORA_PARAMS:
+		return &LoRaParameters{}
+	case MSG_LORA_PACKET:
+		return &LoRaPacketParameters{}
+	case MSG_RX_PARAMS:
+		return &RxParameters{}
+	case MSG_TX_PARAMS:
+		return &TxParameters{}
+	case MSG_FREQUENCY:
+		return &RadioFrequency{}
+	case MSG_FALLBACK_MODE:
+		return &RxTxFallbackMode{}
+	case MSG_RSSI:
+		return &InstantaneousRSSI{}
+	case MSG_RX:
+		return &SwitchToRx{}
+	case MSG_TX:
+		return &Transmit{}
+	case MSG_STANDBY:
+		return &Standby{}
+	case MSG_TIMEOUT:
+		return &RxTxTimeout{}
+	case MSG_PACKET_RECEIVED:
+		return &PacketReceived{}
+	case MSG_PACKET_TRANSMITTED:
+		return &PacketTransmitted{}
+	case MSG_CONTINUOUS_RSSI:
+		return &ContinuoisRSSI{}
+	case MSG_LOGGING:
+		return &DeviceLog{}
+	}
+
+	return nil
+}
+
 //------------------------------------------------------------------------------
 
 type Version struct {
@@ -614,3 +681,52 @@ func (m *ContinuoisRSSI) DeserializeResponse(msg *Message) error {
 
 	return nil
 }
+
+//------------------------------------------------------------------------------
+
+type DeviceLog struct {
+	Level byte
+	Text  string
+}
+
+func (m *DeviceLog) SerializeRequest() Message {
+	message := Message{
+		Type:    MSG_LOGGING,
+		Payload: make([]byte, 1+len(m.Text)),
+	}
+
+	message.Payload[0] = m.Level
+	copy(message.Payload[1:], m.Text)
+
+	return message
+}
+
+func (m *DeviceLog) DeserializeResponse(msg *Message) error {
+	if msg.Type != MSG_LOGGING {
+		return &MessageTypeError{}
+	}
+
+	if len(msg.Payload) < 1 {
+		return &MessagePayloadSizeError{}
+	}
+
+	m.Level = msg.Payload[0]
+	m.Text = string(msg.Payload[1:])
+
+	return nil
+}
+
+func (m *DeviceLog) LevelName() string {
+	switch m.Level {
+	case LOG_DEBUG:
+		return "debug"
+	case LOG_INFO:
+		return "info"
+	case LOG_WARNING:
+		return "warning"
+	case LOG_ERROR:
+		return "error"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bug.st/serial/enumerator"
+)
+
+const (
+	AUTO_PORT = "auto"
+
+	PROBE_TIMEOUT = 500 * time.Millisecond
+)
+
+// USB serial port selection criteria, empty fields match any value.
+type PortFilter struct {
+	Vid          string
+	Pid          string
+	SerialNumber string
+}
+
+func (f *PortFilter) isEmpty() bool {
+	return f.Vid == "" && f.Pid == "" && f.SerialNumber == ""
+}
+
+func (f *PortFilter) matches(port *enumerator.PortDetails) bool {
+	if !port.IsUSB {
+		return false
+	}
+
+	if f.Vid != "" && !strings.EqualFold(f.Vid, port.VID) {
+		return false
+	}
+
+	if f.Pid != "" && !strings.EqualFold(f.Pid, port.PID) {
+		return false
+	}
+
+	if f.SerialNumber != "" && !strings.EqualFold(f.SerialNumber, port.SerialNumber) {
+		return false
+	}
+
+	return true
+}
+
+// Names of the USB serial ports matching the filter.
+func FindPorts(filter *PortFilter) ([]string, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, port := range ports {
+		if filter.matches(port) {
+			names = append(names, port.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// Check whether the port is connected to a device running a compatible firmware.
+func ProbePort(portName string) (Version, error) {
+	apiClient := NewApiClient()
+
+	if err := apiClient.Open(portName); err != nil {
+		return Version{}, err
+	}
+	defer apiClient.Close()
+
+	return apiClient.CheckFirmware(PROBE_TIMEOUT)
+}
+
+/*
+Open the device connected to the port, or discover it with the filter when
+the port name is AUTO_PORT, and make sure it runs a compatible firmware.
+*/
+func OpenDevice(portName string, filter *PortFilter) (*ApiClient, Version, error) {
+	if portName == AUTO_PORT {
+		name, _, err := DiscoverPort(filter)
+		if err != nil {
+			return nil, Version{}, err
+		}
+		portName = name
+	}
+
+	apiClient := NewApiClient()
+
+	if err := apiClient.Open(portName); err != nil {
+		return nil, Version{}, err
+	}
+
+	version, err := apiClient.CheckFirmware(time.Second)
+	if err != nil {
+		apiClient.Close()
+		return nil, version, err
+	}
+
+	return apiClient, version, nil
+}
+
+/*
+Find the first port matching the filter with a compatible device connected.
+The filter is required, so that unrelated serial devices are not probed.
+*/
+func DiscoverPort(filter *PortFilter) (string, Version, error) {
+	if filter == nil || filter.isEmpty() {
+		return "", Version{}, fmt.Errorf("port discovery needs a USB VID, PID or serial number filter")
+	}
+
+	names, err := FindPorts(filter)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	probeErrors := []error{}
+
+	for _, name := range names {
+		version, err := ProbePort(name)
+		if err != nil {
+			probeErrors = append(probeErrors, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		return name, version, nil
+	}
+
+	err = fmt.Errorf("no Waveshare USB-to-LoRa device found (%d candidate ports with VID %s, PID %s, serial number %s)", len(names), filter.Vid, filter.Pid, filter.SerialNumber)
+
+	return "", Version{}, errors.Join(append([]error{err}, probeErrors...)...)
+}
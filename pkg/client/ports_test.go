@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.bug.st/serial/enumerator"
+)
+
+func TestPortFilter(t *testing.T) {
+	port := &enumerator.PortDetails{
+		Name:         "/dev/ttyACM0",
+		IsUSB:        true,
+		VID:          "1a86",
+		PID:          "55d4",
+		SerialNumber: "E6614C311B4C5A2F",
+	}
+
+	assert.True(t, (&PortFilter{}).matches(port))
+	assert.True(t, (&PortFilter{Vid: "1A86", Pid: "55D4"}).matches(port))
+	assert.True(t, (&PortFilter{SerialNumber: "e6614c311b4c5a2f"}).matches(port))
+	assert.False(t, (&PortFilter{Vid: "0483"}).matches(port))
+	assert.False(t, (&PortFilter{SerialNumber: "0000"}).matches(port))
+
+	port.IsUSB = false
+	assert.False(t, (&PortFilter{}).matches(port))
+}
+
+func TestDiscoverPortNeedsFilter(t *testing.T) {
+	// No serial port gets probed without a filter
+	_, _, err := DiscoverPort(nil)
+	assert.ErrorContains(t, err, "needs a USB VID, PID or serial number filter")
+
+	_, _, err = DiscoverPort(&PortFilter{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package client
+
+import "fmt"
+
+// Output power range of the SX1262 high power PA
+const (
+	MIN_TX_POWER = -9
+	MAX_TX_POWER = 22
+)
+
+// SX1262 PA configuration for a nominal output power when the
+// SetTxParams power is +22 dBm, see the datasheet table 13-21.
+type paConfiguration struct {
+	power_dBm int
+	dutyCycle byte
+	hpMax     byte
+}
+
+var sx1262PaConfigurations = []paConfiguration{
+	{14, 0x02, 0x02},
+	{17, 0x02, 0x03},
+	{20, 0x03, 0x05},
+	{22, 0x04, 0x07},
+}
+
+/*
+TX parameters giving the requested output power. The most efficient PA
+configuration able to reach the power is selected, the SetTxParams power
+is then reduced from +22 dBm by the difference to its nominal output power.
+*/
+func TxParametersForPower(power_dBm int, rampTime byte) (*TxParameters, error) {
+	if power_dBm < MIN_TX_POWER || power_dBm > MAX_TX_POWER {
+		return nil, fmt.Errorf("TX power %d dBm is out of the [%d, %d] dBm range", power_dBm, MIN_TX_POWER, MAX_TX_POWER)
+	}
+
+	if rampTime > POWER_RAMP_3400 {
+		return nil, fmt.Errorf("invalid power ramp time 0x%02X", rampTime)
+	}
+
+	for _, pa := range sx1262PaConfigurations {
+		if power_dBm <= pa.power_dBm {
+			return &TxParameters{
+				DutyCycle: pa.dutyCycle,
+				HpMax:     pa.hpMax,
+				Power:     byte(int8(MAX_TX_POWER - (pa.power_dBm - power_dBm))),
+				RampTime:  rampTime,
+			}, nil
+		}
+	}
+
+	// Not reachable, the table covers the whole range
+	return nil, fmt.Errorf("no PA configuration for %d dBm", power_dBm)
+}
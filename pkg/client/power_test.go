@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxParametersForPower(t *testing.T) {
+	params, err := TxParametersForPower(22, POWER_RAMP_200)
+	assert.NoError(t, err)
+	assert.Equal(t, &TxParameters{DutyCycle: 0x04, HpMax: 0x07, Power: 22, RampTime: POWER_RAMP_200}, params)
+
+	params, err = TxParametersForPower(17, POWER_RAMP_80)
+	assert.NoError(t, err)
+	assert.Equal(t, &TxParameters{DutyCycle: 0x02, HpMax: 0x03, Power: 22, RampTime: POWER_RAMP_80}, params)
+
+	params, err = TxParametersForPower(19, POWER_RAMP_80)
+	assert.NoError(t, err)
+	assert.Equal(t, &TxParameters{DutyCycle: 0x03, HpMax: 0x05, Power: 21, RampTime: POWER_RAMP_80}, params)
+
+	params, err = TxParametersForPower(-9, POWER_RAMP_80)
+	assert.NoError(t, err)
+	assert.Equal(t, &TxParameters{DutyCycle: 0x02, HpMax: 0x02, Power: 0xFF, RampTime: POWER_RAMP_80}, params)
+
+	_, err = TxParametersForPower(-10, POWER_RAMP_80)
+	assert.Error(t, err)
+
+	_, err = TxParametersForPower(23, POWER_RAMP_80)
+	assert.Error(t, err)
+
+	_, err = TxParametersForPower(10, 0x08)
+	assert.Error(t, err)
+}
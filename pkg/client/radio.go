@@ -0,0 +1,69 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Timeout of the radio configuration requests
+	REQUEST_TIMEOUT = time.Second
+
+	SWITCH_TO_RX_TIMEOUT = 3 * time.Second
+)
+
+// Set the radio frequency and check that the device accepted it.
+func (c *ApiClient) SetFrequency(frequency_Hz uint32) error {
+	res, err := c.SendRequest(&RadioFrequency{Frequency_Hz: frequency_Hz}, REQUEST_TIMEOUT)
+	if err != nil {
+		return fmt.Errorf("failed to set radio frequency: %v", err)
+	}
+
+	if f, ok := res.(*RadioFrequency); !ok || f.Frequency_Hz != frequency_Hz {
+		return fmt.Errorf("failed to set radio frequency to %d Hz", frequency_Hz)
+	}
+
+	return nil
+}
+
+// Tune the radio to a channel, the frequency can only be changed in standby.
+func (c *ApiClient) Tune(frequency_Hz uint32, loraParams LoRaParameters) error {
+	if err := c.Standby(STANDBY_XOSC); err != nil {
+		return err
+	}
+
+	if err := c.SetFrequency(frequency_Hz); err != nil {
+		return err
+	}
+
+	res, err := c.SendRequest(&loraParams, REQUEST_TIMEOUT)
+	if err != nil {
+		return fmt.Errorf("failed to set LoRa parameters: %v", err)
+	}
+
+	if _, ok := res.(*LoRaParameters); !ok {
+		return fmt.Errorf("failed to set LoRa parameters: invalid response from device")
+	}
+
+	return nil
+}
+
+// Receive continuously.
+func (c *ApiClient) SwitchToRx(continuousRssi bool) error {
+	if _, err := c.SendRequest(&SwitchToRx{
+		Timeout_ms:           0,
+		EnableContinuousRSSI: continuousRssi,
+	}, SWITCH_TO_RX_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to switch to RX mode: %v", err)
+	}
+
+	return nil
+}
+
+func (c *ApiClient) Standby(standbyMode byte) error {
+	if _, err := c.SendRequest(&Standby{StandbyMode: standbyMode}, REQUEST_TIMEOUT); err != nil {
+		return fmt.Errorf("failed to switch to standby mode: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetFrequency(t *testing.T) {
+	a, b := NewPipeTransport()
+
+	apiClient := NewApiClient()
+	assert.NoError(t, apiClient.OpenTransport(a))
+	defer apiClient.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	// The device reports the frequency it is tuned to, off by 1 kHz the second time
+	go func() {
+		for _, offset := range []uint32{0, 1000} {
+			request, err := device.ReceiveMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, byte(MSG_SET_FREQUENCY), request.Type)
+
+			payload := binary.LittleEndian.AppendUint32(nil, binary.LittleEndian.Uint32(request.Payload)+offset)
+			device.SendMessage(&Message{Type: MSG_FREQUENCY, Payload: payload})
+		}
+	}()
+
+	assert.NoError(t, apiClient.SetFrequency(869525000))
+	assert.EqualError(t, apiClient.SetFrequency(869525000), "failed to set radio frequency to 869525000 Hz")
+}
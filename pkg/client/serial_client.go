@@ -2,46 +2,54 @@ package client
 
 import (
 	"fmt"
-	"time"
+	"sync"
 
 	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
-	"go.bug.st/serial"
 )
 
 const (
 	DEFAULT_BAUD_RATE = 115200
 
+	READ_BUFFER_SIZE = 256
+
 	START         = 0xAA
 	ESCAPE        = 0x7D
 	ESCAPE_START  = 0x8A
 	ESCAPE_ESCAPE = 0x5D
 )
 
+func crc16Update(crc uint16, b byte) uint16 {
+	a := (crc >> 8) ^ uint16(b)
+	return (a << 2) ^ (a << 1) ^ a ^ (crc << 8)
+}
+
 func crc16(crc0 uint16, data []byte) uint16 {
 	crc := crc0
 	for _, b := range data {
-		a := (crc >> 8) ^ uint16(b)
-		crc = (a << 2) ^ (a << 1) ^ a ^ (crc << 8)
+		crc = crc16Update(crc, b)
 	}
 	return crc
 }
 
 func escape(data []byte) []byte {
-	escaped := make([]byte, 0)
+	return appendEscaped(make([]byte, 0, 2*len(data)), data)
+}
 
-	for _, b := range data {
-		switch b {
-		case START:
-			escaped = append(escaped, ESCAPE)
-			escaped = append(escaped, ESCAPE_START)
-		case ESCAPE:
-			escaped = append(escaped, ESCAPE)
-			escaped = append(escaped, ESCAPE_ESCAPE)
-		default:
-			escaped = append(escaped, b)
-		}
-	}
-	return escaped
+type CrcError struct {
+	Calculated uint16
+	Received   uint16
+}
+
+func (e *CrcError) Error() string {
+	return fmt.Sprintf("CRC mismatch (calculated 0x%04X, received 0x%04X)", e.Calculated, e.Received)
+}
+
+type FramingError struct {
+	Reason string
+}
+
+func (e *FramingError) Error() string {
+	return e.Reason
 }
 
 type Message struct {
@@ -50,7 +58,20 @@ type Message struct {
 }
 
 type SerialClient struct {
-	port serial.Port
+	port Transport
+
+	readBuffer [READ_BUFFER_SIZE]byte
+	readPos    int
+	readLen    int
+	decoder    frameDecoder
+
+	writeMutex  sync.Mutex
+	writeBuffer []byte
+
+	capture *CaptureWriter
+
+	// Called when recording the capture fails
+	captureFailed func(err error)
 }
 
 func NewSerialClient() *SerialClient {
@@ -61,24 +82,25 @@ func NewSerialClient() *SerialClient {
 	return client
 }
 
+// Open a port by name, see OpenTransport for supported names.
 func (c *SerialClient) Open(portName string) error {
-	mode := &serial.Mode{
-		BaudRate: DEFAULT_BAUD_RATE,
-		Parity:   serial.NoParity,
-		DataBits: 8,
-		StopBits: serial.OneStopBit,
-	}
-
-	port, err := serial.Open(portName, mode)
+	port, err := OpenTransport(portName)
 	if err != nil {
 		return err
 	}
 
-	var timeout time.Duration = 1 * time.Second
-	port.SetReadTimeout(timeout)
+	c.OpenTransport(port)
+	return nil
+}
 
+// Use an already open transport.
+func (c *SerialClient) OpenTransport(port Transport) {
 	c.port = port
-	return nil
+
+	// Discard anything left over from a previous connection
+	c.readPos = 0
+	c.readLen = 0
+	c.decoder.state = stateStart
 }
 
 func (c *SerialClient) Close() error {
@@ -95,74 +117,25 @@ func (c *SerialClient) Close() error {
 	return nil
 }
 
-func (c *SerialClient) IsOpen() bool {
-	return c.port != nil
+// Record all frames sent and received into the capture, nil to stop capturing.
+// Should be set before the port is open.
+func (c *SerialClient) SetCapture(capture *CaptureWriter) {
+	c.capture = capture
 }
 
-func (c *SerialClient) send(data []byte) error {
-	if c.port == nil {
-		return nil
+func (c *SerialClient) recordCapture(direction string, message *Message) {
+	if c.capture == nil {
+		return
 	}
 
-	// Escape the data first
-	data = escape(data)
-
-	packet := make([]byte, 1)
-	packet[0] = START
-
-	packet = append(packet, data...)
-
-	n, err := c.port.Write(packet)
-	if err != nil {
-		return err
+	err := c.capture.Write(direction, message)
+	if err != nil && c.captureFailed != nil {
+		c.captureFailed(err)
 	}
-
-	if n < 1 {
-		return &types.TimeoutError{}
-	}
-
-	return nil
 }
 
-func (c *SerialClient) recv_byte() (byte, error) {
-	// Return error if port is not open
-	if c.port == nil {
-		return 0, fmt.Errorf("port is not open")
-	}
-
-	buf := make([]byte, 1)
-	n, err := c.port.Read(buf)
-
-	if err != nil {
-		return 0, err
-	}
-
-	if n != 1 {
-		return 0, &types.TimeoutError{}
-	}
-
-	if buf[0] != ESCAPE {
-		return buf[0], nil
-	}
-
-	// Read the next byte for the escape sequence
-	n, err = c.port.Read(buf)
-	if err != nil {
-		return 0, err
-	}
-
-	if n < 1 {
-		return 0, fmt.Errorf("incomplete escape sequence")
-	}
-
-	switch buf[0] {
-	case ESCAPE_START:
-		return START, nil
-	case ESCAPE_ESCAPE:
-		return ESCAPE, nil
-	}
-
-	return 0, fmt.Errorf("invalid escape sequence")
+func (c *SerialClient) IsOpen() bool {
+	return c.port != nil
 }
 
 /*
@@ -173,111 +146,64 @@ func (c *SerialClient) SendMessage(message *Message) error {
 		return fmt.Errorf("port is not open")
 	}
 
-	data := make([]byte, 0)
-
-	data = append(data, message.Type)
-
-	payloadLength := uint16(len(message.Payload))
-	data = append(data, byte(payloadLength&0xFF))
-	data = append(data, byte(payloadLength>>8))
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
 
-	data = append(data, message.Payload...)
+	c.writeBuffer = encodeFrame(c.writeBuffer, message)
 
-	crc := crc16(0, data)
-	data = append(data, byte(crc&0xFF))
-	data = append(data, byte(crc>>8))
+	// Captured before writing, so that it precedes the device response
+	c.recordCapture(CAPTURE_TX, message)
 
-	err := c.send(data)
+	n, err := c.port.Write(c.writeBuffer)
 	if err != nil {
 		return err
 	}
 
+	if n < 1 {
+		return &types.TimeoutError{}
+	}
+
 	return nil
 }
 
 /*
 Receive an unstructured message from the serial port.
+The returned message and its payload are only valid until the next call.
 */
 func (c *SerialClient) ReceiveMessage() (*Message, error) {
 	if c.port == nil {
 		return nil, fmt.Errorf("port is not open")
 	}
 
-	startDetected := false
+	for {
+		if c.readPos == c.readLen {
+			n, err := c.port.Read(c.readBuffer[:])
+			if err != nil {
+				return nil, err
+			}
 
-	for !startDetected {
-		b, err := c.recv_byte()
-		if err != nil {
-			return nil, err
-		}
+			if n < 1 {
+				return nil, &types.TimeoutError{}
+			}
 
-		if b == START {
-			startDetected = true
+			c.readPos = 0
+			c.readLen = n
 		}
-	}
 
-	calculatedCrc := uint16(0)
+		for c.readPos < c.readLen {
+			b := c.readBuffer[c.readPos]
+			c.readPos++
 
-	messageType, err := c.recv_byte()
-	if err != nil {
-		return nil, err
-	}
+			complete, err := c.decoder.feed(b)
+			if err != nil {
+				return nil, err
+			}
 
-	calculatedCrc = crc16(calculatedCrc, []byte{messageType})
+			if complete {
+				c.recordCapture(CAPTURE_RX, &c.decoder.message)
 
-	var payloadLengthLsb byte = 0
-	var payloadLengthMsb byte = 0
-
-	payloadLengthLsb, err = c.recv_byte()
-	if err != nil {
-		return nil, err
-	}
-	calculatedCrc = crc16(calculatedCrc, []byte{payloadLengthLsb})
-
-	payloadLengthMsb, err = c.recv_byte()
-	if err != nil {
-		return nil, err
-	}
-	calculatedCrc = crc16(calculatedCrc, []byte{payloadLengthMsb})
-
-	payloadLength := uint16(payloadLengthMsb)<<8 | uint16(payloadLengthLsb)
-
-	var received uint16 = 0
-	payload := make([]byte, payloadLength)
-
-	for received < payloadLength {
-		b, err := c.recv_byte()
-		if err != nil {
-			return nil, err
+				return &c.decoder.message, nil
+			}
 		}
-
-		payload[received] = b
-		received++
-	}
-
-	calculatedCrc = crc16(calculatedCrc, payload)
-
-	var crcLsb byte = 0
-	var crcMsb byte = 0
-
-	crcLsb, err = c.recv_byte()
-	if err != nil {
-		return nil, err
 	}
-
-	crcMsb, err = c.recv_byte()
-	if err != nil {
-		return nil, err
-	}
-
-	crc := uint16(crcMsb)<<8 | uint16(crcLsb)
-
-	if crc != calculatedCrc {
-		return nil, fmt.Errorf("CRC mismatch")
-	}
-
-	return &Message{
-		Type:    messageType,
-		Payload: payload,
-	}, nil
 }
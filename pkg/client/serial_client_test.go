@@ -0,0 +1,154 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPipeClients() (*SerialClient, *SerialClient) {
+	a, b := NewPipeTransport()
+
+	host := NewSerialClient()
+	host.OpenTransport(a)
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+
+	return host, device
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, []byte{0x01, ESCAPE, ESCAPE_START, 0x02, ESCAPE, ESCAPE_ESCAPE}, escape([]byte{0x01, START, 0x02, ESCAPE}))
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	host, device := newPipeClients()
+	defer host.Close()
+	defer device.Close()
+
+	sent := &Message{
+		Type:    MSG_SET_TX,
+		Payload: []byte{0x00, START, ESCAPE, 0x01, 0xFF},
+	}
+
+	go func() {
+		assert.NoError(t, host.SendMessage(sent))
+	}()
+
+	received, err := device.ReceiveMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, sent.Type, received.Type)
+	assert.Equal(t, sent.Payload, received.Payload)
+}
+
+func TestCrcMismatch(t *testing.T) {
+	a, b := NewPipeTransport()
+	defer a.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	go func() {
+		// Version response with a corrupted CRC
+		a.Write([]byte{START, MSG_VERSION, 0x03, 0x00, 0x01, 0x02, 0x03, 0x00, 0x00})
+	}()
+
+	_, err := device.ReceiveMessage()
+	assert.Error(t, err)
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	host, device := newPipeClients()
+	defer host.Close()
+	defer device.Close()
+
+	start := time.Now()
+	_, err := device.ReceiveMessage()
+
+	assert.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), DEFAULT_READ_TIMEOUT)
+}
+
+func TestResynchronizeOnStart(t *testing.T) {
+	a, b := NewPipeTransport()
+	defer a.Close()
+
+	device := NewSerialClient()
+	device.OpenTransport(b)
+	defer device.Close()
+
+	go func() {
+		// Truncated frame followed by a complete one
+		a.Write([]byte{START, MSG_VERSION, 0x03, 0x00, 0x01})
+		a.Write(encodeFrame(nil, &Message{Type: MSG_VERSION, Payload: []byte{1, 2, 3}}))
+	}()
+
+	_, err := device.ReceiveMessage()
+	assert.IsType(t, &FramingError{}, err)
+
+	msg, err := device.ReceiveMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(MSG_VERSION), msg.Type)
+	assert.Equal(t, []byte{1, 2, 3}, msg.Payload)
+}
+
+// Transport replaying the same data over and over, discarding writes.
+type loopTransport struct {
+	data []byte
+	pos  int
+}
+
+func (t *loopTransport) Read(p []byte) (int, error) {
+	n := copy(p, t.data[t.pos:])
+	t.pos = (t.pos + n) % len(t.data)
+	return n, nil
+}
+
+func (t *loopTransport) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (t *loopTransport) Close() error {
+	return nil
+}
+
+func BenchmarkReceiveMessage(b *testing.B) {
+	rssi := (&ContinuoisRSSI{RSSI_dBm: -85}).SerializeRequest()
+	packet := Message{Type: MSG_PACKET_RECEIVED, Payload: make([]byte, 3+64)}
+	for i := range packet.Payload {
+		packet.Payload[i] = byte(i * 7)
+	}
+
+	data := encodeFrame(nil, &rssi)
+	data = append(data, encodeFrame(nil, &packet)...)
+
+	client := NewSerialClient()
+	client.OpenTransport(&loopTransport{data: data})
+
+	b.SetBytes(int64(len(data)) / 2)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := client.ReceiveMessage(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSendMessage(b *testing.B) {
+	message := (&Transmit{Timeout_ms: 8000, Data: make([]byte, 64)}).SerializeRequest()
+
+	client := NewSerialClient()
+	client.OpenTransport(&loopTransport{})
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if err := client.SendMessage(&message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/pty"
+	"go.bug.st/serial"
+)
+
+const (
+	DEFAULT_READ_TIMEOUT = 1 * time.Second
+
+	TCP_PREFIX = "tcp://"
+	PTY_PREFIX = "pty://"
+)
+
+/*
+Byte stream the serial protocol framing runs over.
+Read must return 0 bytes and no error when no data has arrived
+within the transport read timeout.
+*/
+type Transport interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+/*
+Open a transport by name:
+  - "tcp://host:port" connects to a remote serial server (e.g. ser2net),
+  - "pty:///dev/pts/N" opens a pseudo terminal as a plain file,
+  - "replay://path" plays back a capture file,
+  - anything else is treated as a serial port name.
+*/
+func OpenTransport(name string) (Transport, error) {
+	switch {
+	case strings.HasPrefix(name, REPLAY_PREFIX):
+		return NewReplayFileTransport(strings.TrimPrefix(name, REPLAY_PREFIX))
+	case strings.HasPrefix(name, TCP_PREFIX):
+		return NewTcpTransport(strings.TrimPrefix(name, TCP_PREFIX))
+	case strings.HasPrefix(name, PTY_PREFIX):
+		return NewPtyTransport(strings.TrimPrefix(name, PTY_PREFIX))
+	}
+
+	return NewSerialTransport(name)
+}
+
+//------------------------------------------------------------------------------
+
+type serialTransport struct {
+	port serial.Port
+}
+
+// Open a serial port transport.
+func NewSerialTransport(portName string) (Transport, error) {
+	mode := &serial.Mode{
+		BaudRate: DEFAULT_BAUD_RATE,
+		Parity:   serial.NoParity,
+		DataBits: 8,
+		StopBits: serial.OneStopBit,
+	}
+
+	port, err := serial.Open(portName, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = port.SetReadTimeout(DEFAULT_READ_TIMEOUT)
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+
+	return &serialTransport{port: port}, nil
+}
+
+func (t *serialTransport) Read(p []byte) (int, error) {
+	return t.port.Read(p)
+}
+
+func (t *serialTransport) Write(p []byte) (int, error) {
+	return t.port.Write(p)
+}
+
+func (t *serialTransport) Close() error {
+	return t.port.Close()
+}
+
+//------------------------------------------------------------------------------
+
+// Deadline capable connection, implemented by both net.Conn and *os.File.
+type deadlineConn interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+	SetReadDeadline(t time.Time) error
+}
+
+type connTransport struct {
+	conn        deadlineConn
+	readTimeout time.Duration
+}
+
+func newConnTransport(conn deadlineConn) *connTransport {
+	return &connTransport{
+		conn:        conn,
+		readTimeout: DEFAULT_READ_TIMEOUT,
+	}
+}
+
+// Connect to a remote serial port exposed over TCP.
+func NewTcpTransport(address string) (Transport, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConnTransport(conn), nil
+}
+
+// Open a pseudo terminal device in raw mode (Linux only).
+func NewPtyTransport(path string) (Transport, error) {
+	f, err := pty.OpenRaw(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFileTransport(f), nil
+}
+
+// Use an already open pollable file (pty, fifo) as a transport.
+func NewFileTransport(f *os.File) Transport {
+	return newConnTransport(f)
+}
+
+/*
+Create a pair of connected in-memory transports.
+Whatever is written to one end can be read from the other one.
+*/
+func NewPipeTransport() (Transport, Transport) {
+	a, b := net.Pipe()
+	return newConnTransport(a), newConnTransport(b)
+}
+
+func (t *connTransport) Read(p []byte) (int, error) {
+	err := t.conn.SetReadDeadline(time.Now().Add(t.readTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := t.conn.Read(p)
+	if err != nil && isTimeout(err) {
+		// Report timeout the same way a serial port does
+		return n, nil
+	}
+
+	return n, err
+}
+
+func (t *connTransport) Write(p []byte) (int, error) {
+	return t.conn.Write(p)
+}
+
+func (t *connTransport) Close() error {
+	return t.conn.Close()
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,33 @@
+package client
+
+import "fmt"
+
+/*
+Optional firmware features. No firmware release documents them, so they
+are detected from the frames the device sends rather than from its version.
+*/
+type Capabilities struct {
+	ContinuousRssi bool `json:"continuous_rssi"`
+	Logging        bool `json:"logging"`
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Returns -1, 0 or 1 when v is older, same or newer than other.
+func (v Version) Compare(other Version) int {
+	a := []byte{v.Major, v.Minor, v.Patch}
+	b := []byte{other.Major, other.Minor, other.Patch}
+
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+
+	return 0
+}
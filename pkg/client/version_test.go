@@ -0,0 +1,14 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionCompare(t *testing.T) {
+	assert.Equal(t, 0, Version{1, 2, 3}.Compare(Version{1, 2, 3}))
+	assert.Equal(t, -1, Version{1, 2, 3}.Compare(Version{1, 3, 0}))
+	assert.Equal(t, 1, Version{2, 0, 0}.Compare(Version{1, 9, 9}))
+	assert.Equal(t, "1.2.3", Version{1, 2, 3}.String())
+}
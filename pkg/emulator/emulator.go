@@ -0,0 +1,457 @@
+package emulator
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	CONTINUOUS_RSSI_PERIOD = 100 * time.Millisecond
+)
+
+// Version reported unless told otherwise, it does not stand for a firmware release
+var DEFAULT_VERSION = client.Version{Major: 1, Minor: 0, Patch: 0}
+
+type radioMode int
+
+const (
+	modeStandby radioMode = iota
+	modeRx
+	modeTx
+)
+
+/*
+Software stand-in for the Waveshare USB-to-LoRa custom firmware.
+It answers the host requests the same way the device does and
+simulates transmissions and receptions.
+*/
+type Radio struct {
+	serial *client.SerialClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	sendMutex sync.Mutex
+
+	mutex          sync.Mutex
+	version        client.Version
+	loraParams     client.LoRaParameters
+	packetParams   client.LoRaPacketParameters
+	rxParams       client.RxParameters
+	txParams       client.TxParameters
+	frequency      client.RadioFrequency
+	fallbackMode   client.RxTxFallbackMode
+	mode           radioMode
+	continuousRssi bool
+	rxCancel       chan bool
+	rssi_dBm       int16
+
+	// Packets transmitted by the host
+	Transmitted chan []byte
+}
+
+func NewRadio() *Radio {
+	return &Radio{
+		serial:  client.NewSerialClient(),
+		version: DEFAULT_VERSION,
+		loraParams: client.LoRaParameters{
+			SpreadingFactor: client.LORA_SF7,
+			Bandwidth:       client.LORA_BW_125,
+			CodingRate:      client.LORA_CR_4_5,
+		},
+		packetParams: client.LoRaPacketParameters{
+			PreambleLength: 16,
+			SyncWord:       0x2B,
+			CrcOn:          true,
+		},
+		fallbackMode: client.RxTxFallbackMode{FallbackMode: client.FALLBACK_STANDBY_RC},
+		mode:         modeStandby,
+		rssi_dBm:     -120,
+		Transmitted:  make(chan []byte, 10),
+	}
+}
+
+// Set the firmware version reported to the host.
+func (r *Radio) SetVersion(version client.Version) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.version = version
+}
+
+// Set the RSSI reported by instantaneous and continuous RSSI messages.
+func (r *Radio) SetRssi(rssi_dBm int16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rssi_dBm = rssi_dBm
+}
+
+// Current radio frequency as configured by the host.
+func (r *Radio) Frequency() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.frequency.Frequency_Hz
+}
+
+// Current LoRa modulation parameters as configured by the host.
+func (r *Radio) LoRaParameters() client.LoRaParameters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.loraParams
+}
+
+// Current LoRa packet parameters as configured by the host.
+func (r *Radio) PacketParameters() client.LoRaPacketParameters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.packetParams
+}
+
+// Current TX parameters as configured by the host.
+func (r *Radio) TxParameters() client.TxParameters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.txParams
+}
+
+// Current RX parameters as configured by the host.
+func (r *Radio) RxParameters() client.RxParameters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.rxParams
+}
+
+// Current fallback mode as configured by the host.
+func (r *Radio) FallbackMode() byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.fallbackMode.FallbackMode
+}
+
+// Whether the radio is currently receiving.
+func (r *Radio) IsReceiving() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.mode == modeRx
+}
+
+// Start serving the host over the transport.
+func (r *Radio) Open(port client.Transport) error {
+	if r.serial.IsOpen() {
+		return fmt.Errorf("emulator already open")
+	}
+
+	r.serial.OpenTransport(port)
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	r.wg.Go(func() {
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			default:
+				msg, err := r.serial.ReceiveMessage()
+				if err != nil {
+					if _, ok := err.(*types.TimeoutError); ok {
+						continue
+					}
+
+					// Keep going on framing errors, give up once the port is gone
+					if errors.Is(err, io.EOF) || errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed) {
+						return
+					}
+
+					log.With("err", err).Debug("Emulator failed to receive message")
+					continue
+				}
+
+				r.handleRequest(msg)
+			}
+		}
+	})
+
+	r.wg.Go(func() {
+		ticker := time.NewTicker(CONTINUOUS_RSSI_PERIOD)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				r.mutex.Lock()
+				enabled := r.mode == modeRx && r.continuousRssi
+				rssi := r.rssi_dBm
+				r.mutex.Unlock()
+
+				if enabled {
+					r.send((&client.ContinuoisRSSI{RSSI_dBm: rssi}).SerializeRequest())
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func (r *Radio) Close() error {
+	if r.cancel == nil {
+		return nil
+	}
+
+	r.cancel()
+	r.wg.Wait()
+
+	return r.serial.Close()
+}
+
+/*
+Simulate reception of a LoRa packet.
+The packet is only delivered to the host when the radio is in RX mode.
+*/
+func (r *Radio) InjectPacket(data []byte, rssi_dBm int8, snr_dB int8) error {
+	r.mutex.Lock()
+	if r.mode != modeRx {
+		r.mutex.Unlock()
+		return fmt.Errorf("radio is not receiving")
+	}
+
+	// A packet received in single RX mode terminates the reception
+	if r.rxCancel != nil {
+		r.stopRxTimer()
+		r.mode = modeStandby
+	}
+	signalRssi := int8(max(r.rssi_dBm, -128))
+	r.mutex.Unlock()
+
+	payload := make([]byte, 3+len(data))
+	payload[0] = byte(rssi_dBm)
+	payload[1] = byte(snr_dB)
+	payload[2] = byte(signalRssi)
+	copy(payload[3:], data)
+
+	return r.send(client.Message{
+		Type:    client.MSG_PACKET_RECEIVED,
+		Payload: payload,
+	})
+}
+
+// Emit a firmware log message.
+func (r *Radio) Log(level byte, text string) error {
+	return r.send((&client.DeviceLog{Level: level, Text: text}).SerializeRequest())
+}
+
+func (r *Radio) send(message client.Message) error {
+	r.sendMutex.Lock()
+	defer r.sendMutex.Unlock()
+
+	return r.serial.SendMessage(&message)
+}
+
+// Reply with the same payload the request carried.
+func (r *Radio) echo(request *client.Message) {
+	r.send(client.Message{
+		Type:    request.Type | 0x80,
+		Payload: request.Payload,
+	})
+}
+
+// Decode a request payload that has the same layout as the response.
+func decodeEcho(request *client.Message, msg client.ApiMessage) error {
+	return msg.DeserializeResponse(&client.Message{
+		Type:    request.Type | 0x80,
+		Payload: request.Payload,
+	})
+}
+
+func (r *Radio) handleRequest(request *client.Message) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var err error
+
+	switch request.Type {
+	case client.MSG_GET_VERSION:
+		r.send(client.Message{
+			Type:    client.MSG_VERSION,
+			Payload: []byte{r.version.Major, r.version.Minor, r.version.Patch},
+		})
+	case client.MSG_SET_LORA_PARAMS:
+		if err = decodeEcho(request, &r.loraParams); err == nil {
+			r.echo(request)
+		}
+	case client.MSG_SET_LORA_PACKET:
+		if err = decodeEcho(request, &r.packetParams); err == nil {
+			r.echo(request)
+		}
+	case client.MSG_SET_RX_PARAMS:
+		if err = decodeEcho(request, &r.rxParams); err == nil {
+			r.echo(request)
+		}
+	case client.MSG_SET_TX_PARAMS:
+		if err = decodeEcho(request, &r.txParams); err == nil {
+			r.echo(request)
+		}
+	case client.MSG_SET_FREQUENCY:
+		if err = decodeEcho(request, &r.frequency); err == nil {
+			r.echo(request)
+		}
+	case client.MSG_SET_FALLBACK_MODE:
+		if err = decodeEcho(request, &r.fallbackMode); err == nil {
+			r.echo(request)
+		}
+	case client.MSG_GET_RSSI:
+		payload := make([]byte, 2)
+		binary.LittleEndian.PutUint16(payload, uint16(r.rssi_dBm))
+		r.send(client.Message{
+			Type:    client.MSG_RSSI,
+			Payload: payload,
+		})
+	case client.MSG_SET_RX:
+		rx := client.SwitchToRx{}
+		if err = decodeEcho(request, &rx); err == nil {
+			r.switchToRx(&rx)
+			r.echo(request)
+		}
+	case client.MSG_SET_TX:
+		err = r.transmit(request)
+	case client.MSG_SET_STANDBY:
+		standby := client.Standby{}
+		if err = decodeEcho(request, &standby); err == nil {
+			r.stopRxTimer()
+			r.mode = modeStandby
+			r.echo(request)
+		}
+	default:
+		err = fmt.Errorf("unsupported request 0x%02X", request.Type)
+	}
+
+	if err != nil {
+		log.With("err", err).Warn("Emulator rejected request")
+	}
+}
+
+func (r *Radio) switchToRx(rx *client.SwitchToRx) {
+	r.stopRxTimer()
+
+	r.mode = modeRx
+	r.continuousRssi = rx.EnableContinuousRSSI
+
+	if rx.Timeout_ms == 0 {
+		// Continuous reception
+		return
+	}
+
+	cancel := make(chan bool)
+	r.rxCancel = cancel
+	timeout := time.Duration(rx.Timeout_ms) * time.Millisecond
+
+	r.wg.Go(func() {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-cancel:
+			return
+		case <-time.After(timeout):
+		}
+
+		r.mutex.Lock()
+		if r.rxCancel != cancel {
+			r.mutex.Unlock()
+			return
+		}
+		r.rxCancel = nil
+		r.mode = modeStandby
+		r.mutex.Unlock()
+
+		r.send(client.Message{Type: client.MSG_TIMEOUT, Payload: []byte{}})
+	})
+}
+
+func (r *Radio) stopRxTimer() {
+	if r.rxCancel != nil {
+		close(r.rxCancel)
+		r.rxCancel = nil
+	}
+}
+
+func (r *Radio) transmit(request *client.Message) error {
+	if len(request.Payload) < 4 {
+		return &client.MessagePayloadSizeError{}
+	}
+
+	if r.mode == modeTx {
+		r.send(client.Message{Type: client.MSG_TX, Payload: []byte{0x01}})
+		return nil
+	}
+
+	r.stopRxTimer()
+
+	timeout := time.Duration(binary.LittleEndian.Uint32(request.Payload[0:4])) * time.Millisecond
+	data := make([]byte, len(request.Payload)-4)
+	copy(data, request.Payload[4:])
+
+	timeOnAir := client.TimeOnAir(&r.loraParams, &r.packetParams, len(data))
+
+	r.mode = modeTx
+	r.send(client.Message{Type: client.MSG_TX, Payload: []byte{0x00}})
+
+	timedOut := timeout > 0 && timeOnAir > timeout
+	duration := timeOnAir
+	if timedOut {
+		duration = timeout
+	}
+
+	r.wg.Go(func() {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(duration):
+		}
+
+		r.mutex.Lock()
+		if r.fallbackMode.FallbackMode == client.FALLBACK_STANDBY_XOSC_RX {
+			r.mode = modeRx
+		} else {
+			r.mode = modeStandby
+		}
+		r.mutex.Unlock()
+
+		if timedOut {
+			r.send(client.Message{Type: client.MSG_TIMEOUT, Payload: []byte{}})
+			return
+		}
+
+		select {
+		case r.Transmitted <- data:
+		default:
+			// Nobody is watching transmitted packets
+		}
+
+		r.send((&client.PacketTransmitted{
+			TimeOnAir_ms: uint32(timeOnAir / time.Millisecond),
+		}).SerializeRequest())
+	})
+
+	return nil
+}
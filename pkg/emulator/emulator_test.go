@@ -0,0 +1,154 @@
+package emulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func openEmulator(t *testing.T) (*Radio, *client.ApiClient) {
+	host, device := client.NewPipeTransport()
+
+	radio := NewRadio()
+	assert.NoError(t, radio.Open(device))
+
+	apiClient := client.NewApiClient()
+	assert.NoError(t, apiClient.OpenTransport(host))
+
+	t.Cleanup(func() {
+		apiClient.Close()
+		radio.Close()
+	})
+
+	return radio, apiClient
+}
+
+func TestVersion(t *testing.T) {
+	radio, apiClient := openEmulator(t)
+	radio.SetVersion(client.Version{Major: 1, Minor: 2, Patch: 3})
+
+	res, err := apiClient.SendRequest(&client.Version{}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &client.Version{Major: 1, Minor: 2, Patch: 3}, res)
+}
+
+func TestConfigure(t *testing.T) {
+	radio, apiClient := openEmulator(t)
+
+	res, err := apiClient.SendRequest(&client.RadioFrequency{Frequency_Hz: 869525000}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &client.RadioFrequency{Frequency_Hz: 869525000}, res)
+	assert.Equal(t, uint32(869525000), radio.Frequency())
+
+	loraParams := &client.LoRaParameters{
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+	}
+	res, err = apiClient.SendRequest(loraParams, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, loraParams, res)
+	assert.Equal(t, *loraParams, radio.LoRaParameters())
+}
+
+func TestTransmit(t *testing.T) {
+	radio, apiClient := openEmulator(t)
+
+	_, err := apiClient.SendRequest(&client.RxTxFallbackMode{FallbackMode: client.FALLBACK_STANDBY_XOSC_RX}, time.Second)
+	assert.NoError(t, err)
+
+	res, err := apiClient.SendRequest(&client.Transmit{Timeout_ms: 8000, Data: []byte{1, 2, 3}}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &client.Transmit{Busy: false}, res)
+
+	// Device is busy transmitting
+	res, err = apiClient.SendRequest(&client.Transmit{Timeout_ms: 8000, Data: []byte{4}}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &client.Transmit{Busy: true}, res)
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+
+	transmitted, ok := msg.(*client.PacketTransmitted)
+	assert.True(t, ok)
+
+	// SF7, BW125, CR4/5, 16 symbols preamble, 3 bytes payload
+	assert.Equal(t, uint32(39), transmitted.TimeOnAir_ms)
+	assert.Equal(t, []byte{1, 2, 3}, <-radio.Transmitted)
+
+	// Fallback mode switches back to RX
+	assert.True(t, radio.IsReceiving())
+}
+
+func TestTransmitTimeout(t *testing.T) {
+	_, apiClient := openEmulator(t)
+
+	_, err := apiClient.SendRequest(&client.Transmit{Timeout_ms: 1, Data: []byte{1, 2, 3}}, time.Second)
+	assert.NoError(t, err)
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &client.RxTxTimeout{}, msg)
+}
+
+func TestReceive(t *testing.T) {
+	radio, apiClient := openEmulator(t)
+
+	assert.Error(t, radio.InjectPacket([]byte{1, 2, 3}, -80, 5))
+
+	_, err := apiClient.SendRequest(&client.SwitchToRx{Timeout_ms: 0, EnableContinuousRSSI: true}, time.Second)
+	assert.NoError(t, err)
+
+	radio.SetRssi(-101)
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &client.ContinuoisRSSI{RSSI_dBm: -101}, msg)
+
+	_, err = apiClient.SendRequest(&client.SwitchToRx{Timeout_ms: 0, EnableContinuousRSSI: false}, time.Second)
+	assert.NoError(t, err)
+
+	// Drain RSSI messages sent before continuous RSSI was disabled
+	for {
+		assert.NoError(t, radio.InjectPacket([]byte{1, 2, 3}, -80, 5))
+
+		msg, err = apiClient.ReceiveMessage(time.Second)
+		assert.NoError(t, err)
+
+		if _, ok := msg.(*client.ContinuoisRSSI); !ok {
+			break
+		}
+	}
+
+	assert.Equal(t, &client.PacketReceived{
+		PacketRSSI_dBm: -80,
+		PacketSNR_dB:   5,
+		SignalRSSI_dBm: -101,
+		Data:           []byte{1, 2, 3},
+	}, msg)
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	radio, apiClient := openEmulator(t)
+
+	_, err := apiClient.SendRequest(&client.SwitchToRx{Timeout_ms: 50}, time.Second)
+	assert.NoError(t, err)
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &client.RxTxTimeout{}, msg)
+	assert.False(t, radio.IsReceiving())
+}
+
+func TestDeviceLog(t *testing.T) {
+	radio, apiClient := openEmulator(t)
+
+	assert.NoError(t, radio.Log(client.LOG_WARNING, "radio busy"))
+
+	msg, err := apiClient.ReceiveMessage(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &client.DeviceLog{Level: client.LOG_WARNING, Text: "radio busy"}, msg)
+	assert.Equal(t, "warning", msg.(*client.DeviceLog).LevelName())
+}
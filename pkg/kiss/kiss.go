@@ -0,0 +1,175 @@
+package kiss
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Special characters
+const (
+	FEND  = 0xC0
+	FESC  = 0xDB
+	TFEND = 0xDC
+	TFESC = 0xDD
+)
+
+// Commands, the low nibble of the type byte
+const (
+	CMD_DATA         = 0x00
+	CMD_TX_DELAY     = 0x01
+	CMD_PERSISTENCE  = 0x02
+	CMD_SLOT_TIME    = 0x03
+	CMD_TX_TAIL      = 0x04
+	CMD_FULL_DUPLEX  = 0x05
+	CMD_SET_HARDWARE = 0x06
+	CMD_RETURN       = 0xFF
+)
+
+// Longest frame accepted from a client, LoRa payloads are at most 255 bytes.
+const MAX_FRAME_LENGTH = 1024
+
+/*
+KISS frame.
+See http://www.ax25.net/kiss.aspx
+*/
+type Frame struct {
+	Port    byte
+	Command byte
+	Data    []byte
+}
+
+type FrameTooLongError struct{}
+
+func (e *FrameTooLongError) Error() string {
+	return fmt.Sprintf("KISS frame exceeds %d bytes", MAX_FRAME_LENGTH)
+}
+
+type InvalidEscapeError struct {
+	Value byte
+}
+
+func (e *InvalidEscapeError) Error() string {
+	return fmt.Sprintf("invalid KISS escape sequence 0x%02X 0x%02X", FESC, e.Value)
+}
+
+// Append the frame delimited and escaped.
+func (f *Frame) Append(buffer []byte) []byte {
+	typ := f.Port<<4 | f.Command&0x0F
+	if f.Command == CMD_RETURN {
+		typ = CMD_RETURN
+	}
+
+	buffer = append(buffer, FEND)
+	buffer = appendEscaped(buffer, typ)
+
+	for _, b := range f.Data {
+		buffer = appendEscaped(buffer, b)
+	}
+
+	return append(buffer, FEND)
+}
+
+func appendEscaped(buffer []byte, b byte) []byte {
+	switch b {
+	case FEND:
+		return append(buffer, FESC, TFEND)
+	case FESC:
+		return append(buffer, FESC, TFESC)
+	}
+
+	return append(buffer, b)
+}
+
+type Reader struct {
+	reader *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(r)}
+}
+
+/*
+Read the next frame. Empty frames between delimiters are skipped,
+a malformed frame returns an error and reading can carry on with the next one.
+*/
+func (r *Reader) ReadFrame() (*Frame, error) {
+	// Skip anything before the frame start
+	for {
+		b, err := r.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == FEND {
+			break
+		}
+	}
+
+	data := []byte{}
+	escaped := false
+	var frameErr error
+
+	for {
+		b, err := r.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if b == FEND {
+			if frameErr != nil {
+				r.reader.UnreadByte()
+				return nil, frameErr
+			}
+
+			if len(data) == 0 {
+				// Back to back delimiters
+				continue
+			}
+
+			// Keep the delimiter, it may start the next frame
+			r.reader.UnreadByte()
+			break
+		}
+
+		if frameErr != nil {
+			continue
+		}
+
+		if escaped {
+			escaped = false
+
+			switch b {
+			case TFEND:
+				b = FEND
+			case TFESC:
+				b = FESC
+			default:
+				frameErr = &InvalidEscapeError{Value: b}
+				continue
+			}
+		} else if b == FESC {
+			escaped = true
+			continue
+		}
+
+		if len(data) >= MAX_FRAME_LENGTH {
+			frameErr = &FrameTooLongError{}
+			continue
+		}
+
+		data = append(data, b)
+	}
+
+	frame := &Frame{
+		Port:    data[0] >> 4,
+		Command: data[0] & 0x0F,
+		Data:    data[1:],
+	}
+
+	if data[0] == CMD_RETURN {
+		frame.Port = 0
+		frame.Command = CMD_RETURN
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,86 @@
+package kiss
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameAppend(t *testing.T) {
+	frame := &Frame{Port: 1, Command: CMD_DATA, Data: []byte{0x01, FEND, 0x02, FESC}}
+
+	assert.Equal(t, []byte{FEND, 0x10, 0x01, FESC, TFEND, 0x02, FESC, TFESC, FEND}, frame.Append(nil))
+
+	frame = &Frame{Command: CMD_RETURN}
+	assert.Equal(t, []byte{FEND, 0xFF, FEND}, frame.Append(nil))
+}
+
+func TestReadFrame(t *testing.T) {
+	input := []byte{
+		0x55, // Noise before the first frame
+		FEND, FEND, 0x00, 0x01, FESC, TFEND, FESC, TFESC, FEND,
+		0x26, 0x01, 0x02, FEND,
+		FEND, 0x00, FESC, 0x42, 0x03, FEND,
+		FEND, 0x00, 0x04, FEND,
+	}
+
+	reader := NewReader(bytes.NewReader(input))
+
+	frame, err := reader.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, &Frame{Port: 0, Command: CMD_DATA, Data: []byte{0x01, FEND, FESC}}, frame)
+
+	// Shares the delimiter with the previous frame
+	frame, err = reader.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, &Frame{Port: 2, Command: CMD_SET_HARDWARE, Data: []byte{0x01, 0x02}}, frame)
+
+	_, err = reader.ReadFrame()
+	assert.IsType(t, &InvalidEscapeError{}, err)
+
+	// Carries on after a malformed frame
+	frame, err = reader.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, &Frame{Port: 0, Command: CMD_DATA, Data: []byte{0x04}}, frame)
+
+	_, err = reader.ReadFrame()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadFrameTooLong(t *testing.T) {
+	input := []byte{FEND}
+	input = append(input, make([]byte, MAX_FRAME_LENGTH+1)...)
+	input = append(input, FEND, 0x00, 0x01, FEND)
+
+	reader := NewReader(bytes.NewReader(input))
+
+	_, err := reader.ReadFrame()
+	assert.IsType(t, &FrameTooLongError{}, err)
+
+	frame, err := reader.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, frame.Data)
+}
+
+func TestRoundTrip(t *testing.T) {
+	frames := []*Frame{
+		{Port: 0, Command: CMD_DATA, Data: []byte{FEND, FESC, TFEND, TFESC}},
+		{Port: 15, Command: CMD_TX_DELAY, Data: []byte{50}},
+		{Port: 0, Command: CMD_RETURN, Data: []byte{}},
+	}
+
+	buffer := []byte{}
+	for _, frame := range frames {
+		buffer = frame.Append(buffer)
+	}
+
+	reader := NewReader(bytes.NewReader(buffer))
+
+	for _, frame := range frames {
+		decoded, err := reader.ReadFrame()
+		assert.NoError(t, err)
+		assert.Equal(t, frame, decoded)
+	}
+}
@@ -0,0 +1,169 @@
+package meshtastic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+const (
+	DEFAULT_DUTY_CYCLE_WINDOW    = time.Hour
+	DEFAULT_DUTY_CYCLE_MAX_DELAY = time.Minute
+)
+
+// A packet that cannot be transmitted without exceeding the airtime budget.
+type AirtimeExceededError struct {
+	Size      int
+	TimeOnAir time.Duration
+	Used      time.Duration
+	Budget    time.Duration
+	Window    time.Duration
+	Delay     time.Duration // Wait required for the packet to fit, 0 if it never fits
+}
+
+func (e *AirtimeExceededError) Error() string {
+	if e.Delay == 0 {
+		return fmt.Sprintf("packet time on air %v exceeds the airtime budget of %v per %v", e.TimeOnAir, e.Budget, e.Window)
+	}
+
+	return fmt.Sprintf("packet time on air %v would exceed the airtime budget (%v of %v used per %v) for another %v",
+		e.TimeOnAir, e.Used, e.Budget, e.Window, e.Delay)
+}
+
+type airtimeRecord struct {
+	transmitted time.Time
+	timeOnAir   time.Duration
+}
+
+/*
+Sliding window airtime budget, the time on air of the packets transmitted
+within the window must not exceed the duty cycle share of the window.
+Not safe for concurrent use.
+*/
+type AirtimeLimiter struct {
+	window  time.Duration
+	budget  time.Duration
+	records []airtimeRecord
+}
+
+func NewAirtimeLimiter(dutyCycle_percent float64, window time.Duration) *AirtimeLimiter {
+	return &AirtimeLimiter{
+		window:  window,
+		budget:  time.Duration(float64(window) * dutyCycle_percent / 100),
+		records: []airtimeRecord{},
+	}
+}
+
+func (l *AirtimeLimiter) Budget() time.Duration {
+	return l.budget
+}
+
+func (l *AirtimeLimiter) Window() time.Duration {
+	return l.window
+}
+
+// Airtime used within the window ending now.
+func (l *AirtimeLimiter) Used(now time.Time) time.Duration {
+	l.forget(now)
+
+	var used time.Duration = 0
+	for _, r := range l.records {
+		used += r.timeOnAir
+	}
+
+	return used
+}
+
+/*
+Time to wait until a transmission fits the budget, 0 when it can go now.
+An error is returned if it would never fit.
+*/
+func (l *AirtimeLimiter) Delay(now time.Time, timeOnAir time.Duration) (time.Duration, error) {
+	used := l.Used(now)
+
+	if timeOnAir > l.budget {
+		return 0, &AirtimeExceededError{TimeOnAir: timeOnAir, Used: used, Budget: l.budget, Window: l.window}
+	}
+
+	excess := used + timeOnAir - l.budget
+	if excess <= 0 {
+		return 0, nil
+	}
+
+	// Wait for enough of the oldest transmissions to leave the window
+	for _, r := range l.records {
+		excess -= r.timeOnAir
+		if excess <= 0 {
+			return r.transmitted.Add(l.window).Sub(now), nil
+		}
+	}
+
+	// Not reachable, the budget covers the packet once the window is empty
+	return l.window, nil
+}
+
+// Account for a transmission.
+func (l *AirtimeLimiter) Record(now time.Time, timeOnAir time.Duration) {
+	l.records = append(l.records, airtimeRecord{transmitted: now, timeOnAir: timeOnAir})
+}
+
+func (l *AirtimeLimiter) forget(now time.Time) {
+	i := 0
+	for i < len(l.records) && !l.records[i].transmitted.Add(l.window).After(now) {
+		i++
+	}
+
+	l.records = l.records[i:]
+}
+
+//------------------------------------------------------------------------------
+
+// Time on air of a packet with the configured modulation and packet parameters.
+func (r *RadioConfiguration) TimeOnAir(payloadLength int) time.Duration {
+	loraParams := r.LoRaParameters()
+	packetParams := r.PacketParameters()
+
+	return client.TimeOnAir(&loraParams, &packetParams, payloadLength)
+}
+
+/*
+Airtime limiter for the configured duty cycle, or the duty cycle of the
+regulatory band when only the region is configured. Nil when unlimited.
+Also returns how long a packet may be delayed to fit the budget.
+*/
+func (r *RadioConfiguration) airtimeLimiter() (*AirtimeLimiter, time.Duration, error) {
+	dutyCycle_percent := 100.0
+	window := DEFAULT_DUTY_CYCLE_WINDOW
+	maxDelay := DEFAULT_DUTY_CYCLE_MAX_DELAY
+
+	if r.Region != "" {
+		band, err := LookupBand(r.Region, r.Frequency, byte(r.Bandwidth))
+		if err != nil {
+			return nil, 0, err
+		}
+		dutyCycle_percent = band.DutyCycle_percent
+	}
+
+	if r.DutyCycle != nil {
+		if r.DutyCycle.Percent > 0 {
+			dutyCycle_percent = r.DutyCycle.Percent
+		}
+		if r.DutyCycle.Window > 0 {
+			window = time.Duration(r.DutyCycle.Window)
+		}
+		if r.DutyCycle.MaxDelay > 0 {
+			maxDelay = time.Duration(r.DutyCycle.MaxDelay)
+		}
+	}
+
+	if dutyCycle_percent > 100 {
+		return nil, 0, fmt.Errorf("invalid duty cycle %v%%", dutyCycle_percent)
+	}
+
+	if dutyCycle_percent == 100 {
+		return nil, 0, nil
+	}
+
+	return NewAirtimeLimiter(dutyCycle_percent, window), maxDelay, nil
+}
@@ -0,0 +1,102 @@
+package meshtastic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAirtimeLimiter(t *testing.T) {
+	// 36 s per hour
+	limiter := NewAirtimeLimiter(1, time.Hour)
+	assert.Equal(t, 36*time.Second, limiter.Budget())
+
+	start := time.Now()
+
+	delay, err := limiter.Delay(start, 20*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+	limiter.Record(start, 20*time.Second)
+
+	delay, err = limiter.Delay(start.Add(time.Minute), 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+	limiter.Record(start.Add(time.Minute), 10*time.Second)
+
+	assert.Equal(t, 30*time.Second, limiter.Used(start.Add(2*time.Minute)))
+
+	// Fits once the first transmission leaves the window
+	delay, err = limiter.Delay(start.Add(2*time.Minute), 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 58*time.Minute, delay)
+
+	assert.Equal(t, 10*time.Second, limiter.Used(start.Add(time.Hour)))
+
+	delay, err = limiter.Delay(start.Add(time.Hour), 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+
+	// Never fits
+	_, err = limiter.Delay(start, time.Minute)
+	assert.IsType(t, &AirtimeExceededError{}, err)
+}
+
+func TestRadioConfigurationAirtime(t *testing.T) {
+	cfg := RadioConfiguration{
+		Region:          "EU_868",
+		Frequency:       869525000,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+	}
+
+	// 78.25 symbols of 8.192 ms
+	assert.Equal(t, 641024*time.Microsecond, cfg.TimeOnAir(50))
+
+	limiter, maxDelay, err := cfg.airtimeLimiter()
+	assert.NoError(t, err)
+	assert.Equal(t, 6*time.Minute, limiter.Budget())
+	assert.Equal(t, DEFAULT_DUTY_CYCLE_MAX_DELAY, maxDelay)
+
+	cfg.DutyCycle = &DutyCycleConfiguration{Percent: 1, Window: types.Duration(10 * time.Minute)}
+	limiter, _, err = cfg.airtimeLimiter()
+	assert.NoError(t, err)
+	assert.Equal(t, 6*time.Second, limiter.Budget())
+
+	cfg.Region = ""
+	cfg.DutyCycle = nil
+	limiter, _, err = cfg.airtimeLimiter()
+	assert.NoError(t, err)
+	assert.Nil(t, limiter)
+}
+
+func TestMeshtasticClientAirtimeRejection(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+		// 360 ms per minute, less than a single packet
+		DutyCycle: &DutyCycleConfiguration{Percent: 0.6, Window: types.Duration(time.Minute)},
+	})
+
+	meshtasticClient.OutgoingPackets <- make([]byte, 40)
+
+	select {
+	case rejection := <-meshtasticClient.AirtimeRejections:
+		assert.Equal(t, 40, rejection.Size)
+		assert.Equal(t, 360*time.Millisecond, rejection.Budget)
+	case <-time.After(time.Second):
+		t.Fatal("packet has not been rejected")
+	}
+
+	select {
+	case <-radio.Transmitted:
+		t.Fatal("packet has been transmitted")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
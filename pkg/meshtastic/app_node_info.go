@@ -27,6 +27,8 @@ type NodeInfoApplicationIncomingMessage struct {
 	Rssi       int32        `json:"rssi"`
 	Snr        float32      `json:"snr"`
 	Hops       uint32       `json:"hops"`
+	NextHop    uint32       `json:"next_hop"`
+	RelayNode  uint32       `json:"relay_node"`
 }
 
 type NodeInfoApplication struct {
@@ -108,6 +110,8 @@ func (app *NodeInfoApplication) HandleIncomingPacket(meshPacket *pb.MeshPacket)
 		Rssi:       meshPacket.RxRssi,
 		Snr:        meshPacket.RxSnr,
 		Hops:       meshPacket.HopStart - meshPacket.HopLimit,
+		NextHop:    meshPacket.NextHop,
+		RelayNode:  meshPacket.RelayNode,
 	}
 
 	jsonMessage, err := json.Marshal(&message)
@@ -106,6 +106,8 @@ func (app *PositionApplication) HandleIncomingPacket(meshPacket *pb.MeshPacket)
 	data["rssi"] = meshPacket.RxRssi
 	data["snr"] = meshPacket.RxSnr
 	data["hops"] = meshPacket.HopStart - meshPacket.HopLimit
+	data["next_hop"] = meshPacket.NextHop
+	data["relay_node"] = meshPacket.RelayNode
 
 	jsonData, err = json.Marshal(data)
 	if err != nil {
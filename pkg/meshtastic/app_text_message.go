@@ -17,6 +17,8 @@ type TextApplicationIncomingMessage struct {
 	Rssi      int32        `json:"rssi"`
 	Snr       float32      `json:"snr"`
 	Hops      uint32       `json:"hops"`
+	NextHop   uint32       `json:"next_hop"`
+	RelayNode uint32       `json:"relay_node"`
 }
 
 type TextApplicationOutgoingMessage struct {
@@ -102,6 +104,8 @@ func (app *TextApplication) HandleIncomingPacket(meshPacket *pb.MeshPacket) erro
 			Rssi:      meshPacket.RxRssi,
 			Snr:       meshPacket.RxSnr,
 			Hops:      meshPacket.HopStart - meshPacket.HopLimit,
+			NextHop:   meshPacket.NextHop,
+			RelayNode: meshPacket.RelayNode,
 		}
 
 		jsonMessage, err := json.Marshal(textMessage)
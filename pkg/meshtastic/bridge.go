@@ -0,0 +1,92 @@
+package meshtastic
+
+import (
+	"slices"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	pb "github.com/meshtastic/go/generated"
+)
+
+/*
+Relays packets received on one radio to another. Packets are only matched by channel
+and port number when they can be decoded, empty filters match every packet.
+*/
+type bridge struct {
+	from     *nodeRadio
+	to       *nodeRadio
+	channels []uint32
+	portNums []pb.PortNum
+}
+
+// The configuration is validated when loaded.
+func (n *Node) newBridge(config *BridgeConfiguration) *bridge {
+	b := &bridge{
+		channels: config.Channels,
+	}
+
+	for _, radio := range n.radios {
+		if radio.name == config.From {
+			b.from = radio
+		}
+		if radio.name == config.To {
+			b.to = radio
+		}
+	}
+
+	for _, name := range config.PortNums {
+		portNum, _ := parsePortNum(name)
+		b.portNums = append(b.portNums, portNum)
+	}
+
+	return b
+}
+
+func (b *bridge) matches(meshPacket *pb.MeshPacket) bool {
+	if len(b.channels) == 0 && len(b.portNums) == 0 {
+		return true
+	}
+
+	if meshPacket == nil {
+		// Unknown channel, can't tell
+		return false
+	}
+
+	if len(b.channels) > 0 && !slices.Contains(b.channels, meshPacket.Channel) {
+		return false
+	}
+
+	if len(b.portNums) > 0 {
+		decoded, ok := meshPacket.PayloadVariant.(*pb.MeshPacket_Decoded)
+		if !ok || !slices.Contains(b.portNums, decoded.Decoded.Portnum) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+Relay a received packet according to the bridges. Packets bridged back are
+dropped by the duplicate filtering of the radio that transmitted them.
+*/
+func (n *Node) bridgePacket(radio *nodeRadio, packet *client.PacketReceived, meshPacket *pb.MeshPacket) {
+	var data []byte
+
+	for _, b := range n.bridges {
+		if b.from != radio || !b.matches(meshPacket) {
+			continue
+		}
+
+		if data == nil {
+			forwarded, ok := forwardedPacket(packet, LastByteOfNodeId(n.id))
+			if !ok {
+				return
+			}
+			data = forwarded
+		}
+
+		b.to.logger.With("from", radio.name).Debug("Bridging packet")
+
+		b.to.send(data)
+	}
+}
@@ -0,0 +1,34 @@
+package meshtastic
+
+import (
+	"testing"
+
+	pb "github.com/meshtastic/go/generated"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridgeMatches(t *testing.T) {
+	text := &pb.MeshPacket{
+		Channel: 1,
+		PayloadVariant: &pb.MeshPacket_Decoded{
+			Decoded: &pb.Data{Portnum: pb.PortNum_TEXT_MESSAGE_APP},
+		},
+	}
+
+	all := &bridge{}
+	assert.True(t, all.matches(text))
+	assert.True(t, all.matches(nil))
+
+	byChannel := &bridge{channels: []uint32{0}}
+	assert.False(t, byChannel.matches(text))
+	assert.False(t, byChannel.matches(nil))
+
+	byChannel.channels = []uint32{0, 1}
+	assert.True(t, byChannel.matches(text))
+
+	byPortNum := &bridge{portNums: []pb.PortNum{pb.PortNum_POSITION_APP}}
+	assert.False(t, byPortNum.matches(text))
+
+	byPortNum.portNums = append(byPortNum.portNums, pb.PortNum_TEXT_MESSAGE_APP)
+	assert.True(t, byPortNum.matches(text))
+}
@@ -36,31 +36,59 @@ func NewChannel(id uint32, name string, key []byte) *Channel {
 	}
 }
 
-func (c *Channel) DecodePacket(packet *client.PacketReceived) (*pb.MeshPacket, error) {
-	hash := packet.Data[13]
-	if hash != c.hash {
-		return nil, fmt.Errorf("channel hash mismatch (expected %d, received %d)", c.hash, hash)
+// Expand the short "AQ==" key to the Meshtastic default channel key.
+func ExpandChannelKey(key []byte) []byte {
+	if len(key) == 1 && key[0] == 0x01 {
+		return defaultPublicKey
 	}
 
-	toNode := binary.LittleEndian.Uint32(packet.Data[0:4])
-	fromNode := binary.LittleEndian.Uint32(packet.Data[4:8])
-	packetId := binary.LittleEndian.Uint32(packet.Data[8:12])
-	flags := packet.Data[12]
+	return key
+}
 
-	nonce := make([]byte, 16)
-	binary.LittleEndian.PutUint64(nonce[0:8], uint64(packetId))
-	binary.LittleEndian.PutUint32(nonce[8:12], fromNode)
+/*
+Decrypt a raw packet of this channel. The returned packet has the same
+16 bytes header followed by the decrypted payload.
+*/
+func (c *Channel) Decrypt(data []byte) ([]byte, error) {
+	header, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
 
-	encryptedPayload := packet.Data[16:]
+	if header.Hash != c.hash {
+		return nil, fmt.Errorf("channel hash mismatch (expected %d, received %d)", c.hash, header.Hash)
+	}
+
+	nonce := make([]byte, 16)
+	binary.LittleEndian.PutUint64(nonce[0:8], uint64(header.Id))
+	binary.LittleEndian.PutUint32(nonce[8:12], header.From)
 
 	block, err := aes.NewCipher(c.encryptionKey)
 	if err != nil {
 		return nil, err
 	}
 
+	decrypted := make([]byte, len(data))
+	copy(decrypted[0:HEADER_LENGTH], data[0:HEADER_LENGTH])
+
 	stream := cipher.NewCTR(block, nonce)
-	decrypted := make([]byte, len(encryptedPayload))
-	stream.XORKeyStream(decrypted, encryptedPayload)
+	stream.XORKeyStream(decrypted[HEADER_LENGTH:], data[HEADER_LENGTH:])
+
+	return decrypted, nil
+}
+
+func (c *Channel) DecodePacket(packet *client.PacketReceived) (*pb.MeshPacket, error) {
+	decryptedPacket, err := c.Decrypt(packet.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := ParseHeader(decryptedPacket)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := decryptedPacket[HEADER_LENGTH:]
 
 	data := &pb.Data{}
 	err = proto.Unmarshal(decrypted, data)
@@ -69,18 +97,20 @@ func (c *Channel) DecodePacket(packet *client.PacketReceived) (*pb.MeshPacket, e
 	}
 
 	meshPacket := &pb.MeshPacket{
-		From:         fromNode,
-		To:           toNode,
-		Id:           packetId,
+		From:         header.From,
+		To:           header.Dest,
+		Id:           header.Id,
 		PkiEncrypted: true,
 		PublicKey:    c.encryptionKey,
 		Channel:      c.id,
 		RxRssi:       int32(packet.PacketRSSI_dBm),
 		RxSnr:        float32(packet.PacketSNR_dB),
-		HopLimit:     uint32(flags & 0x07),
-		WantAck:      flags&0x08 != 0,
-		ViaMqtt:      flags&0x10 != 0,
-		HopStart:     uint32(flags >> 5),
+		HopLimit:     header.HopLimit(),
+		WantAck:      header.WantAck(),
+		ViaMqtt:      header.ViaMqtt(),
+		HopStart:     header.HopStart(),
+		NextHop:      uint32(header.NextHop),
+		RelayNode:    uint32(header.RelayNode),
 	}
 
 	meshPacket.PayloadVariant = &pb.MeshPacket_Decoded{Decoded: data}
@@ -111,8 +141,9 @@ func (c *Channel) EncodePacket(meshPacket *pb.MeshPacket) ([]byte, error) {
 	packet = append(packet, flags)
 	packet = append(packet, c.hash)
 
-	// @todo should we put the hop value in here?
-	packet = binary.LittleEndian.AppendUint16(packet, 0)
+	// Only the last byte of the node ids is carried in the header
+	packet = append(packet, byte(meshPacket.NextHop))
+	packet = append(packet, byte(meshPacket.RelayNode))
 
 	block, err := aes.NewCipher(c.encryptionKey)
 	if err != nil {
@@ -0,0 +1,81 @@
+package meshtastic
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
+)
+
+// Size of the unencrypted header preceding every Meshtastic packet
+const HEADER_LENGTH = 16
+
+const (
+	FLAG_HOP_LIMIT_MASK = 0x07
+	FLAG_WANT_ACK       = 0x08
+	FLAG_VIA_MQTT       = 0x10
+	FLAG_HOP_START_MASK = 0xE0
+)
+
+type PacketTooShortError struct {
+	Length int
+}
+
+func (e *PacketTooShortError) Error() string {
+	return fmt.Sprintf("packet is too short (%d bytes)", e.Length)
+}
+
+/*
+Meshtastic packet header:
+
+	dest (LE32) | from (LE32) | id (LE32) | flags | channel hash | next hop | relay node
+
+Next hop and relay node are the last bytes of the node ids, zero when unknown.
+*/
+type Header struct {
+	Dest      uint32
+	From      uint32
+	Id        uint32
+	Flags     byte
+	Hash      byte
+	NextHop   byte
+	RelayNode byte
+}
+
+// Parse the header of a received packet, the payload that follows is not checked.
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < HEADER_LENGTH {
+		return nil, &PacketTooShortError{Length: len(data)}
+	}
+
+	return &Header{
+		Dest:      binary.LittleEndian.Uint32(data[0:4]),
+		From:      binary.LittleEndian.Uint32(data[4:8]),
+		Id:        binary.LittleEndian.Uint32(data[8:12]),
+		Flags:     data[12],
+		Hash:      data[13],
+		NextHop:   data[14],
+		RelayNode: data[15],
+	}, nil
+}
+
+// Last byte of a node id, the way next hop and relay node are carried in the header.
+func LastByteOfNodeId(id types.NodeId) byte {
+	return byte(id & 0xFF)
+}
+
+func (h *Header) HopLimit() uint32 {
+	return uint32(h.Flags & FLAG_HOP_LIMIT_MASK)
+}
+
+func (h *Header) HopStart() uint32 {
+	return uint32(h.Flags&FLAG_HOP_START_MASK) >> 5
+}
+
+func (h *Header) WantAck() bool {
+	return h.Flags&FLAG_WANT_ACK != 0
+}
+
+func (h *Header) ViaMqtt() bool {
+	return h.Flags&FLAG_VIA_MQTT != 0
+}
@@ -0,0 +1,106 @@
+package meshtastic
+
+import (
+	"testing"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	pb "github.com/meshtastic/go/generated"
+	"github.com/stretchr/testify/assert"
+)
+
+var helloPacket = []byte{
+	0xff, 0xff, 0xff, 0xff,
+	0x44, 0x33, 0x22, 0x11,
+	0x5f, 0xb1, 0x3e, 0xfb,
+	0xe7,       // Flags
+	0x08,       // Hash
+	0x00, 0x00, // Next hop, relay node
+	0x7d, 0x7f, 0xa9, 0x49, 0x1a, 0xd1, 0x39, 0xf4,
+	0xf9, 0xf3, 0x57, 0x5b, 0x83, 0x05, 0x4d, 0xa6,
+	0xdb, 0x2c, 0x25, 0xa8, 0x82, 0x25, 0x5f, 0xa4,
+	0x7e, 0x91, 0x9f, 0xff, 0x39,
+}
+
+func TestParseHeader(t *testing.T) {
+	header, err := ParseHeader(helloPacket)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint32(0xFFFFFFFF), header.Dest)
+	assert.Equal(t, uint32(0x11223344), header.From)
+	assert.Equal(t, uint32(0xFB3EB15F), header.Id)
+	assert.Equal(t, byte(0x08), header.Hash)
+	assert.Equal(t, byte(0x00), header.NextHop)
+	assert.Equal(t, byte(0x00), header.RelayNode)
+	assert.Equal(t, uint32(7), header.HopLimit())
+	assert.Equal(t, uint32(7), header.HopStart())
+	assert.False(t, header.WantAck())
+	assert.False(t, header.ViaMqtt())
+
+	_, err = ParseHeader(helloPacket[:HEADER_LENGTH-1])
+	assert.Equal(t, &PacketTooShortError{Length: HEADER_LENGTH - 1}, err)
+}
+
+func TestMalformedPacketIsNotForwarded(t *testing.T) {
+	_, ok := forwardedPacket(&client.PacketReceived{Data: helloPacket[:12]}, 0x55)
+	assert.False(t, ok)
+}
+
+func TestForwardedPacketRelayNode(t *testing.T) {
+	data, ok := forwardedPacket(&client.PacketReceived{Data: helloPacket}, LastByteOfNodeId(0x12345678))
+	assert.True(t, ok)
+
+	header, err := ParseHeader(data)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(6), header.HopLimit())
+	assert.Equal(t, uint32(7), header.HopStart())
+	assert.Equal(t, byte(0x00), header.NextHop)
+	assert.Equal(t, byte(0x78), header.RelayNode)
+
+	// The received packet is left untouched
+	assert.Equal(t, byte(0x00), helloPacket[15])
+}
+
+func FuzzParseHeader(f *testing.F) {
+	f.Add(helloPacket)
+	f.Add(helloPacket[:HEADER_LENGTH])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := ParseHeader(data)
+		if len(data) < HEADER_LENGTH {
+			assert.Error(t, err)
+			return
+		}
+
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, header.HopLimit(), uint32(7))
+		assert.LessOrEqual(t, header.HopStart(), uint32(7))
+	})
+}
+
+func FuzzDecodePacket(f *testing.F) {
+	f.Add(helloPacket)
+	f.Add(helloPacket[:HEADER_LENGTH])
+	f.Add(helloPacket[:13])
+	f.Add([]byte{})
+
+	channel := NewChannel(0, "LongFast", defaultPublicKey)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		meshPacket, err := channel.DecodePacket(&client.PacketReceived{Data: data})
+		if err != nil {
+			return
+		}
+
+		// Whatever decodes is encoded back to the same header
+		decoded, ok := meshPacket.PayloadVariant.(*pb.MeshPacket_Decoded)
+		assert.True(t, ok)
+		assert.NotNil(t, decoded.Decoded)
+
+		header, err := ParseHeader(data)
+		assert.NoError(t, err)
+		assert.Equal(t, header.From, meshPacket.From)
+		assert.Equal(t, header.Dest, meshPacket.To)
+		assert.Equal(t, header.Id, meshPacket.Id)
+	})
+}
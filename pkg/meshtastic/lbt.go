@@ -0,0 +1,140 @@
+package meshtastic
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	LBT_DEFAULT_THRESHOLD         = -90 // dBm
+	LBT_DEFAULT_CONTENTION_WINDOW = 100 * time.Millisecond
+	LBT_DEFAULT_MAX_ATTEMPTS      = 5
+)
+
+// Listen-before-talk counters
+type ListenBeforeTalkStats struct {
+	Sampled  uint64 `json:"sampled"`
+	Deferred uint64 `json:"deferred"`
+	Forced   uint64 `json:"forced"`
+}
+
+type listenBeforeTalk struct {
+	threshold        int32
+	contentionWindow time.Duration
+	maxAttempts      int
+}
+
+// Packet waiting for the channel to become clear
+type deferredPacket struct {
+	packet  *RawPacket
+	attempt int
+}
+
+func newListenBeforeTalk(config *ListenBeforeTalkConfiguration) *listenBeforeTalk {
+	lbt := &listenBeforeTalk{
+		threshold:        config.Threshold,
+		contentionWindow: time.Duration(config.ContentionWindow),
+		maxAttempts:      config.MaxAttempts,
+	}
+
+	if lbt.threshold == 0 {
+		lbt.threshold = LBT_DEFAULT_THRESHOLD
+	}
+
+	if lbt.contentionWindow <= 0 {
+		lbt.contentionWindow = LBT_DEFAULT_CONTENTION_WINDOW
+	}
+
+	if lbt.maxAttempts <= 0 {
+		lbt.maxAttempts = LBT_DEFAULT_MAX_ATTEMPTS
+	}
+
+	return lbt
+}
+
+// Random backoff, the contention window doubles with every attempt.
+func (l *listenBeforeTalk) backoff(attempt int) time.Duration {
+	window := l.contentionWindow << min(attempt, 6)
+
+	return time.Duration(rand.Int64N(int64(window))) + 1
+}
+
+/*
+Check that the configured channel is clear before transmitting the packet.
+When it is busy the packet is deferred by a random backoff,
+it is transmitted anyway once the attempts are exhausted.
+*/
+func (c *MeshtasticClient) listenBeforeTalk(packet *RawPacket, attempt int) bool {
+	if c.lbt == nil {
+		return true
+	}
+
+	rssi, err := c.channelRssi()
+	if err != nil {
+		// Better to risk a collision than to stop transmitting
+		c.Warnings <- fmt.Errorf("listen before talk: %w", err)
+		return true
+	}
+
+	c.lbtStats.sampled.Add(1)
+
+	if rssi <= c.lbt.threshold {
+		return true
+	}
+
+	if attempt >= c.lbt.maxAttempts {
+		c.lbtStats.forced.Add(1)
+		log.With("rssi", rssi, "attempts", attempt).Warn("Channel still busy, transmitting anyway")
+		return true
+	}
+
+	c.lbtStats.deferred.Add(1)
+
+	backoff := c.lbt.backoff(attempt)
+	log.With("rssi", rssi, "threshold", c.lbt.threshold, "backoff", backoff).Debug("Channel busy, packet deferred")
+
+	c.wg.Go(func() {
+		select {
+		case <-c.ctx.Done():
+		case <-time.After(backoff):
+			select {
+			case <-c.ctx.Done():
+			case c.deferredPackets <- deferredPacket{packet: packet, attempt: attempt + 1}:
+			}
+		}
+	})
+
+	return false
+}
+
+// Current channel RSSI, the latest continuous RSSI when enabled, sampled otherwise.
+func (c *MeshtasticClient) channelRssi() (int32, error) {
+	if c.continuousRssi {
+		return c.rssi_dBm.Load(), nil
+	}
+
+	res, err := c.apiClient.SendRequest(&client.InstantaneousRSSI{}, time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sample RSSI: %w", err)
+	}
+
+	rssi, ok := res.(*client.InstantaneousRSSI)
+	if !ok {
+		return 0, fmt.Errorf("failed to sample RSSI: invalid response from device")
+	}
+
+	return int32(rssi.RSSI_dBm), nil
+}
+
+// Listen-before-talk counters.
+func (c *MeshtasticClient) ListenBeforeTalkStats() ListenBeforeTalkStats {
+	return ListenBeforeTalkStats{
+		Sampled:  c.lbtStats.sampled.Load(),
+		Deferred: c.lbtStats.deferred.Load(),
+		Forced:   c.lbtStats.forced.Load(),
+	}
+}
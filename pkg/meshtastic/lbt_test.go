@@ -0,0 +1,55 @@
+package meshtastic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeshtasticClientListenBeforeTalk(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF7,
+		Bandwidth:       client.LORA_BW_500,
+		CodingRate:      client.LORA_CR_4_5,
+		ListenBeforeTalk: &ListenBeforeTalkConfiguration{
+			Threshold:        -90,
+			ContentionWindow: types.Duration(10 * time.Millisecond),
+			MaxAttempts:      2,
+		},
+	})
+	radio.SetRssi(-70)
+
+	packet := make([]byte, 20)
+	packet[11] = 1
+
+	// Busy channel, deferred until the attempts are exhausted
+	meshtasticClient.OutgoingPackets <- packet
+
+	select {
+	case transmitted := <-radio.Transmitted:
+		assert.Equal(t, packet, transmitted)
+	case <-time.After(2 * time.Second):
+		t.Fatal("packet has not been transmitted")
+	}
+
+	assert.Equal(t, ListenBeforeTalkStats{Sampled: 3, Deferred: 2, Forced: 1}, meshtasticClient.ListenBeforeTalkStats())
+
+	// Clear channel
+	radio.SetRssi(-110)
+	packet[11] = 2
+	meshtasticClient.OutgoingPackets <- packet
+
+	select {
+	case transmitted := <-radio.Transmitted:
+		assert.Equal(t, packet, transmitted)
+	case <-time.After(2 * time.Second):
+		t.Fatal("packet has not been transmitted")
+	}
+
+	assert.Equal(t, ListenBeforeTalkStats{Sampled: 4, Deferred: 2, Forced: 1}, meshtasticClient.ListenBeforeTalkStats())
+}
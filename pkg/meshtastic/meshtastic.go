@@ -2,9 +2,9 @@ package meshtastic
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 	"math/rand/v2"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,16 +14,6 @@ import (
 	"github.com/charmbracelet/log"
 )
 
-type Header struct {
-	Dest      uint32
-	From      uint32
-	Id        uint32
-	Flags     byte
-	Hash      byte
-	NextHop   byte
-	RelayNode byte
-}
-
 type PacketTimespamp struct {
 	dest     uint32
 	from     uint32
@@ -31,6 +21,18 @@ type PacketTimespamp struct {
 	received time.Time
 }
 
+const (
+	RECONNECT_MIN_DELAY = 1 * time.Second
+	RECONNECT_MAX_DELAY = 30 * time.Second
+)
+
+type ConnectionState struct {
+	Connected bool
+	Port      string
+	Firmware  client.Version
+	Err       error
+}
+
 type MeshtasticClient struct {
 	apiClient *client.ApiClient
 	ctx       context.Context
@@ -40,12 +42,55 @@ type MeshtasticClient struct {
 	rssi_dBm       atomic.Int32
 	timeOnAir_ms   atomic.Uint32
 	continuousRssi bool
+	raw            bool
+
+	// Guards the device details below, portName and the
+	// radioConfig settings changed at runtime
+	deviceMutex     sync.Mutex
+	firmwareVersion client.Version
+	capabilities    client.Capabilities
+
+	// Used to reopen the device after a disconnection
+	portName     string
+	autoDiscover bool
+	portFilter   *client.PortFilter
+	radioConfig  *RadioConfiguration
+
+	// Only used by the processing loop
+	airtime         *AirtimeLimiter
+	airtimeMaxDelay time.Duration
+	lbt             *listenBeforeTalk
+	retuned         bool
+
+	lbtStats struct {
+		sampled  atomic.Uint64
+		deferred atomic.Uint64
+		forced   atomic.Uint64
+	}
+	deferredPackets chan deferredPacket
+
+	// Functions to run on the processing loop
+	controls chan func()
+
+	// Whether the device is usable, cleared while reconnecting
+	connected atomic.Bool
+
+	// Port of the reopened device, the loop then restores the radio
+	reconnected chan string
 
 	seenPackets []PacketTimespamp
 
 	IncomingPackets chan *client.PacketReceived
 	OutgoingPackets chan []byte
 	Rssi            chan int32
+	DeviceLogs      chan *client.DeviceLog
+	Connection      chan ConnectionState
+
+	// Packets transmitted with optional frequency and spreading factor overrides
+	OutgoingRawPackets chan *RawPacket
+
+	// Outgoing packets dropped to stay within the duty cycle
+	AirtimeRejections chan *AirtimeExceededError
 
 	Errors   chan error
 	Warnings chan error
@@ -57,30 +102,145 @@ func NewMeshtasticClient() *MeshtasticClient {
 		apiClient:       client.NewApiClient(),
 		IncomingPackets: make(chan *client.PacketReceived, 10),
 		OutgoingPackets: make(chan []byte, 10),
+		deferredPackets: make(chan deferredPacket, 10),
+		controls:        make(chan func()),
+		reconnected:     make(chan string),
 		Rssi:            make(chan int32, 10),
+		DeviceLogs:      make(chan *client.DeviceLog, 10),
+		Connection:      make(chan ConnectionState, 10),
 		Errors:          make(chan error, 10),
 		Warnings:        make(chan error, 10),
+
+		OutgoingRawPackets: make(chan *RawPacket, 10),
+		AirtimeRejections:  make(chan *AirtimeExceededError, 10),
 	}
 }
 
+// Look the device up by its USB identifiers when discovering it and when reconnecting,
+// so that it is found even if it enumerates under a different port name.
+func (c *MeshtasticClient) SetPortFilter(filter *client.PortFilter) {
+	c.portFilter = filter
+}
+
+// Record the serial traffic with the device.
+func (c *MeshtasticClient) SetCapture(capture *client.CaptureWriter) {
+	c.apiClient.SetCapture(capture)
+}
+
 // Open serial port to talk to the LoRa device and
 // start receiving Meshtastic messages.
+// Use client.AUTO_PORT as port name to discover the device.
 func (c *MeshtasticClient) Open(portName string, radioConfig *RadioConfiguration) error {
+	c.autoDiscover = portName == client.AUTO_PORT
+
+	if c.autoDiscover {
+		name, err := c.discoverPort()
+		if err != nil {
+			return err
+		}
+		portName = name
+	}
+
 	err := c.apiClient.Open(portName)
 	if err != nil {
 		return err
 	}
 
+	c.setPortName(portName)
+
+	return c.start(radioConfig)
+}
+
+// Same as Open, but talks to the device over an already open transport.
+func (c *MeshtasticClient) OpenTransport(port client.Transport, radioConfig *RadioConfiguration) error {
+	err := c.apiClient.OpenTransport(port)
+	if err != nil {
+		return err
+	}
+
+	return c.start(radioConfig)
+}
+
+func (c *MeshtasticClient) start(radioConfig *RadioConfiguration) error {
 	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.radioConfig = radioConfig
+
+	airtime, maxDelay, err := radioConfig.airtimeLimiter()
+	if err != nil {
+		return err
+	}
+	c.airtime = airtime
+	c.airtimeMaxDelay = maxDelay
+
+	if airtime != nil {
+		log.With("budget", airtime.Budget(), "window", airtime.Window()).Info("Airtime limited")
+	}
+
+	c.lbt = nil
+	if radioConfig.ListenBeforeTalk != nil {
+		c.lbt = newListenBeforeTalk(radioConfig.ListenBeforeTalk)
+		log.With("threshold", c.lbt.threshold, "contentionWindow", c.lbt.contentionWindow).Info("Listen before talk enabled")
+	}
 
 	err = c.initRadio(radioConfig)
 	if err != nil {
 		return err
 	}
 
+	c.connected.Store(true)
+
 	c.wg.Go(func() {
 		var retransmissions atomic.Int32
 
+		send := func(outgoingPacket *RawPacket, lbtAttempt int) {
+			if !c.connected.Load() {
+				c.reportError(fmt.Errorf("packet dropped: %w", &types.DisconnectedError{}))
+				return
+			}
+
+			if err := c.checkOverrides(outgoingPacket); err != nil {
+				c.Errors <- fmt.Errorf("packet dropped: %w", err)
+				return
+			}
+
+			if !c.checkAirtime(outgoingPacket) {
+				return
+			}
+
+			if !c.listenBeforeTalk(outgoingPacket, lbtAttempt) {
+				return
+			}
+
+			err := c.transmitPacket(outgoingPacket)
+
+			if err != nil {
+				_, ok := err.(*types.BusyError)
+				if ok {
+					if retransmissions.Load() > 2 {
+						c.Errors <- fmt.Errorf("Too many retransmissions, packet dropped")
+					} else {
+						retransmissions.Add(1)
+						c.Warnings <- fmt.Errorf("Device is busy, packet is scheduled for retransmission (%d pending)", retransmissions.Load())
+
+						retransmitAfter := time.Duration(1000+rand.Uint32N(1000)) * time.Millisecond
+						go func() {
+							// Device is busy, trying again after some time
+							select {
+							case <-c.ctx.Done():
+								return
+							case <-time.After(retransmitAfter):
+								c.deferredPackets <- deferredPacket{packet: outgoingPacket}
+								retransmissions.Add(-1)
+							}
+						}()
+					}
+
+				} else {
+					c.Errors <- fmt.Errorf("packet transmission failed: %v", err)
+				}
+			}
+		}
+
 	loop:
 		for {
 			select {
@@ -88,39 +248,26 @@ func (c *MeshtasticClient) Open(portName string, radioConfig *RadioConfiguration
 				break loop
 			case radioMessage := <-c.apiClient.Recv:
 				c.handleRadioMessage(radioMessage)
+			case err := <-c.apiClient.Disconnected:
+				c.disconnected(err)
+			case portName := <-c.reconnected:
+				c.restoreRadio(portName)
+			case err := <-c.apiClient.Errors:
+				c.Warnings <- fmt.Errorf("device communication error: %w", err)
 			case outgoingPacket := <-c.OutgoingPackets:
-				err := c.transmitPacket(outgoingPacket)
-
-				if err != nil {
-					_, ok := err.(*types.BusyError)
-					if ok {
-						if retransmissions.Load() > 2 {
-							c.Errors <- fmt.Errorf("Too many retransmissions, packet dropped")
-						} else {
-							retransmissions.Add(1)
-							c.Warnings <- fmt.Errorf("Device is busy, packet is scheduled for retransmission (%d pending)", retransmissions.Load())
-
-							retransmitAfter := time.Duration(1000+rand.Uint32N(1000)) * time.Millisecond
-							go func() {
-								// Device is busy, trying again after some time
-								select {
-								case <-c.ctx.Done():
-									return
-								case <-time.After(retransmitAfter):
-									c.OutgoingPackets <- outgoingPacket
-									retransmissions.Add(-1)
-								}
-							}()
-						}
-
-					} else {
-						c.Errors <- fmt.Errorf("packet transmission failed: %v", err)
-					}
-				}
+				send(&RawPacket{Data: outgoingPacket}, 0)
+			case outgoingPacket := <-c.OutgoingRawPackets:
+				send(outgoingPacket, 0)
+			case deferred := <-c.deferredPackets:
+				send(deferred.packet, deferred.attempt)
+			case control := <-c.controls:
+				control()
 			}
 		}
 
-		_ = c.deinitRadio()
+		if c.connected.Load() {
+			_ = c.deinitRadio()
+		}
 	})
 
 	return nil
@@ -138,131 +285,419 @@ func (c *MeshtasticClient) Close() error {
 	return c.apiClient.Close()
 }
 
-func (c *MeshtasticClient) initRadio(radioConfig *RadioConfiguration) error {
-	c.continuousRssi = radioConfig.ContinuousRssi
+/*
+Stop using the device after the serial port has failed and start reconnecting.
+The processing loop keeps running meanwhile, failing outgoing packets and controls.
+*/
+func (c *MeshtasticClient) disconnected(cause error) {
+	c.connected.Store(false)
 
-	// Switch back to RX once the message has been transmitted
-	if _, err := c.apiClient.SendRequest(&client.RxTxFallbackMode{
-		FallbackMode: client.FALLBACK_STANDBY_XOSC_RX,
-	}, time.Second); err != nil {
-		return fmt.Errorf("failed to set radio standby mode: %v", err.Error())
-	}
+	portName := c.PortName()
 
-	// Frequency
-	res, err := c.apiClient.SendRequest(&client.RadioFrequency{
-		Frequency_Hz: radioConfig.Frequency,
-	}, time.Second)
-	if err != nil {
-		return fmt.Errorf("failed to set radio frequency: %v", err.Error())
+	if strings.HasPrefix(portName, client.REPLAY_PREFIX) {
+		// Playing the capture again would duplicate its traffic
+		log.With("port", portName).Info("Replay finished")
+	} else {
+		log.With("err", cause, "port", portName).Error("Device disconnected")
 	}
+	c.Connection <- ConnectionState{Connected: false, Port: portName, Err: cause}
 
-	f, ok := res.(*client.RadioFrequency)
-	if !ok {
-		return fmt.Errorf("failed to set radio frequency: invalid response from device")
+	_ = c.apiClient.Close()
+
+	if strings.HasPrefix(portName, client.REPLAY_PREFIX) {
+		return
 	}
 
-	if f.Frequency_Hz != radioConfig.Frequency {
-		return fmt.Errorf("failed to set radio frequency to %d Hz", radioConfig.Frequency)
+	if portName == "" {
+		// Opened over a transport we cannot reopen
+		c.reportError(fmt.Errorf("unable to reconnect to device: %v", cause))
+		return
 	}
 
-	var txParams *client.TxParameters = nil
+	c.wg.Go(c.reconnect)
+}
 
-	switch radioConfig.Power {
-	case 14:
-		txParams = &client.TxParameters{
-			DutyCycle: 0x02,
-			HpMax:     0x02,
-			Power:     0x0E,
-			RampTime:  0x03,
-		}
-	case 17:
-		txParams = &client.TxParameters{
-			DutyCycle: 0x02,
-			HpMax:     0x03,
-			Power:     0x11,
-			RampTime:  0x03,
-		}
-	case 20:
-		txParams = &client.TxParameters{
-			DutyCycle: 0x03,
-			HpMax:     0x05,
-			Power:     0x14,
-			RampTime:  0x03,
+/*
+Wait for the device to come back and reopen its port.
+The radio is configured by the processing loop, which owns the radio state.
+*/
+func (c *MeshtasticClient) reconnect() {
+	delay := RECONNECT_MIN_DELAY
+
+	var portName string
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
 		}
-	case 22:
-		txParams = &client.TxParameters{
-			DutyCycle: 0x04,
-			HpMax:     0x07,
-			Power:     0x16,
-			RampTime:  0x03,
+
+		name, err := c.reopen()
+		if err == nil {
+			portName = name
+			break
 		}
+
+		log.With("err", err, "retryIn", delay).Warn("Failed to reconnect to device")
+
+		delay = min(2*delay, RECONNECT_MAX_DELAY)
+	}
+
+	select {
+	case <-c.ctx.Done():
+	case c.reconnected <- portName:
+	}
+}
+
+// Configure the reopened device, called from the processing loop.
+func (c *MeshtasticClient) restoreRadio(portName string) {
+	if err := c.initRadio(c.radioConfig); err != nil {
+		log.With("err", err, "port", portName).Warn("Failed to restore the radio configuration")
+		_ = c.apiClient.Close()
+		c.wg.Go(c.reconnect)
+		return
+	}
+
+	c.setPortName(portName)
+	c.connected.Store(true)
+
+	log.With("port", portName).Info("Device reconnected")
+	c.Connection <- ConnectionState{Connected: true, Port: portName, Firmware: c.FirmwareVersion()}
+}
+
+// Report an error without blocking the caller, nobody may be reading the channel.
+func (c *MeshtasticClient) reportError(err error) {
+	select {
+	case c.Errors <- err:
+	default:
+		log.With("err", err).Error("Meshtastic client error")
+	}
+}
+
+// Queue a packet for transmission, fails when the device is disconnected or the queue is full.
+func (c *MeshtasticClient) Send(packet []byte) error {
+	if !c.connected.Load() {
+		return &types.DisconnectedError{}
+	}
+
+	select {
+	case c.OutgoingPackets <- packet:
+		return nil
+	default:
+		return fmt.Errorf("outgoing queue is full")
+	}
+}
+
+// Same as Send, for packets with radio overrides.
+func (c *MeshtasticClient) SendRaw(packet *RawPacket) error {
+	if !c.connected.Load() {
+		return &types.DisconnectedError{}
+	}
+
+	select {
+	case c.OutgoingRawPackets <- packet:
+		return nil
 	default:
-		return fmt.Errorf("unsupported TX power value: %d", radioConfig.Power)
+		return fmt.Errorf("outgoing queue is full")
+	}
+}
+
+func (c *MeshtasticClient) discoverPort() (string, error) {
+	name, version, err := client.DiscoverPort(c.portFilter)
+	if err != nil {
+		return "", err
+	}
+
+	log.With("port", name, "firmware", version.String()).Info("Discovered device")
+
+	return name, nil
+}
+
+// Open the port of the device again, returns the port name.
+func (c *MeshtasticClient) reopen() (string, error) {
+	portName := c.PortName()
+
+	// An explicitly given port is reopened as is, the filter only applies to discovery
+	if c.autoDiscover {
+		name, err := c.discoverPort()
+		if err != nil {
+			return "", err
+		}
+		portName = name
+	}
+
+	if err := c.apiClient.Open(portName); err != nil {
+		return "", err
+	}
+
+	return portName, nil
+}
+
+// Serial communication statistics.
+func (c *MeshtasticClient) Stats() client.ApiClientStats {
+	return c.apiClient.Stats()
+}
+
+// Name of the port the device is connected to.
+func (c *MeshtasticClient) PortName() string {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+
+	return c.portName
+}
+
+func (c *MeshtasticClient) setPortName(portName string) {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+
+	c.portName = portName
+}
+
+// Firmware version reported by the device.
+func (c *MeshtasticClient) FirmwareVersion() client.Version {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+
+	return c.firmwareVersion
+}
+
+// Optional features the device firmware has been seen using since it was opened.
+func (c *MeshtasticClient) Capabilities() client.Capabilities {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+
+	return c.capabilities
+}
+
+// Query the firmware version, the capabilities are detected again from the frames it sends.
+func (c *MeshtasticClient) checkFirmware() error {
+	res, err := c.apiClient.SendRequest(&client.Version{}, time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to query firmware version: %v", err)
+	}
+
+	version, ok := res.(*client.Version)
+	if !ok {
+		return fmt.Errorf("failed to query firmware version: invalid response from device")
+	}
+
+	c.deviceMutex.Lock()
+	c.firmwareVersion = *version
+	c.capabilities = client.Capabilities{}
+	c.deviceMutex.Unlock()
+
+	log.With("version", version.String()).Info("Device firmware")
+
+	return nil
+}
+
+// Record a capability the device has just been seen using.
+func (c *MeshtasticClient) detectCapability(set func(capabilities *client.Capabilities)) {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+
+	set(&c.capabilities)
+}
+
+func (c *MeshtasticClient) initRadio(radioConfig *RadioConfiguration) error {
+	if err := c.checkFirmware(); err != nil {
+		return err
+	}
+
+	c.continuousRssi = radioConfig.ContinuousRssi
+
+	if err := c.applyFallbackMode(radioConfig.FallbackMode.OrDefault()); err != nil {
+		return err
+	}
+
+	if err := c.applyRxBoost(radioConfig.RxBoost); err != nil {
+		return err
+	}
+
+	if err := c.apiClient.SetFrequency(radioConfig.Frequency); err != nil {
+		return err
+	}
+
+	txParams, err := radioConfig.TxParameters()
+	if err != nil {
+		return err
 	}
 
 	if _, err := c.apiClient.SendRequest(txParams, time.Second); err != nil {
 		return fmt.Errorf("failed to configure TX parameters: %v", err)
 	}
 
-	_, err = c.apiClient.SendRequest(&client.LoRaParameters{
-		SpreadingFactor: byte(radioConfig.SpreadingFactor),
-		Bandwidth:       byte(radioConfig.Bandwidth),
-		CodingRate:      byte(radioConfig.CodingRate),
-		LowDataRate:     false,
-	}, time.Second)
+	loraParams := radioConfig.LoRaParameters()
+
+	log.With(
+		"symbolDuration", client.SymbolDuration(loraParams.SpreadingFactor, loraParams.Bandwidth),
+		"lowDataRate", loraParams.LowDataRate,
+		"override", radioConfig.LowDataRate != nil,
+	).Info("LoRa low data rate optimisation")
+
+	_, err = c.apiClient.SendRequest(&loraParams, time.Second)
 
 	if err != nil {
 		return fmt.Errorf("failed to set LoRa parameters: %v", err)
 	}
 
+	// Packet parameters
+	packetParams := radioConfig.PacketParameters()
+
+	res, err := c.apiClient.SendRequest(&packetParams, time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to set LoRa packet parameters: %v", err)
+	}
+
+	p, ok := res.(*client.LoRaPacketParameters)
+	if !ok {
+		return fmt.Errorf("failed to set LoRa packet parameters: invalid response from device")
+	}
+
+	if *p != packetParams {
+		return fmt.Errorf("failed to set LoRa packet parameters: requested %+v, device has %+v", packetParams, *p)
+	}
+
 	// Start receiving
 	return c.switchToRx()
 }
 
-func (c *MeshtasticClient) deinitRadio() error {
-	_, err := c.apiClient.SendRequest(&client.Standby{StandbyMode: client.STANDBY_XOSC}, time.Second)
+func (c *MeshtasticClient) applyFallbackMode(mode LoRaFallbackMode) error {
+	res, err := c.apiClient.SendRequest(&client.RxTxFallbackMode{FallbackMode: byte(mode)}, time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to switch to standby mode: %v", err)
+		return fmt.Errorf("failed to set radio fallback mode: %v", err)
+	}
+
+	fm, ok := res.(*client.RxTxFallbackMode)
+	if !ok {
+		return fmt.Errorf("failed to set radio fallback mode: invalid response from device")
 	}
+
+	if LoRaFallbackMode(fm.FallbackMode) != mode {
+		return fmt.Errorf("failed to set radio fallback mode to %s", mode)
+	}
+
 	return nil
 }
 
-func (c *MeshtasticClient) switchToRx() error {
-	_, err := c.apiClient.SendRequest(
-		&client.SwitchToRx{
-			Timeout_ms:           0,
-			EnableContinuousRSSI: c.continuousRssi,
-		},
-		3*time.Second,
-	)
-
+func (c *MeshtasticClient) applyRxBoost(enabled bool) error {
+	res, err := c.apiClient.SendRequest(&client.RxParameters{RxBoost: enabled}, time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to switch to RX mode: %v", err)
+		return fmt.Errorf("failed to set RX parameters: %v", err)
+	}
+
+	rx, ok := res.(*client.RxParameters)
+	if !ok {
+		return fmt.Errorf("failed to set RX parameters: invalid response from device")
+	}
+
+	if rx.RxBoost != enabled {
+		return fmt.Errorf("failed to set RX boost to %t", enabled)
 	}
 
 	return nil
 }
 
+// Run a function on the processing loop and wait for its result.
+func (c *MeshtasticClient) runInLoop(f func() error) error {
+	if c.ctx == nil {
+		return fmt.Errorf("client is not running")
+	}
+
+	if !c.connected.Load() {
+		return &types.DisconnectedError{}
+	}
+
+	result := make(chan error, 1)
+
+	select {
+	case <-c.ctx.Done():
+		return fmt.Errorf("client is closed")
+	case c.controls <- func() { result <- f() }:
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return fmt.Errorf("client is closed")
+	case err := <-result:
+		return err
+	}
+}
+
+// Enable or disable the RX boosted gain, the setting is kept across reconnections.
+func (c *MeshtasticClient) SetRxBoost(enabled bool) error {
+	return c.runInLoop(func() error {
+		if err := c.applyRxBoost(enabled); err != nil {
+			return err
+		}
+
+		c.deviceMutex.Lock()
+		c.radioConfig.RxBoost = enabled
+		c.deviceMutex.Unlock()
+
+		return nil
+	})
+}
+
+// Change the radio fallback mode, the setting is kept across reconnections.
+func (c *MeshtasticClient) SetFallbackMode(mode LoRaFallbackMode) error {
+	return c.runInLoop(func() error {
+		if err := c.applyFallbackMode(mode); err != nil {
+			return err
+		}
+
+		c.deviceMutex.Lock()
+		c.radioConfig.FallbackMode = mode
+		c.deviceMutex.Unlock()
+
+		return nil
+	})
+}
+
+// Current RX boost and fallback mode settings.
+func (c *MeshtasticClient) RxSettings() (bool, LoRaFallbackMode) {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+
+	if c.radioConfig == nil {
+		return false, LoRaFallbackMode(0).OrDefault()
+	}
+
+	return c.radioConfig.RxBoost, c.radioConfig.FallbackMode.OrDefault()
+}
+
+func (c *MeshtasticClient) deinitRadio() error {
+	return c.apiClient.Standby(client.STANDBY_XOSC)
+}
+
+func (c *MeshtasticClient) switchToRx() error {
+	return c.apiClient.SwitchToRx(c.continuousRssi)
+}
+
 func (c *MeshtasticClient) handleRadioMessage(msg client.ApiMessage) {
 	var shouldSwitchToRx bool = false
 
 	if packet, ok := msg.(*client.PacketReceived); ok {
 		shouldSwitchToRx = true
 
-		// Purge records of older packets
-		c.forgetOldSeenPackets()
+		if c.raw {
+			// Frames of any format, nothing to deduplicate
+			c.IncomingPackets <- packet
+		} else if header, err := ParseHeader(packet.Data); err != nil {
+			// Noise or a foreign frame
+			c.Warnings <- fmt.Errorf("malformed packet dropped: %w", err)
+		} else {
+			// Purge records of older packets
+			c.forgetOldSeenPackets()
 
-		record := PacketTimespamp{
-			dest:     binary.BigEndian.Uint32(packet.Data[0:4]),
-			from:     binary.BigEndian.Uint32(packet.Data[4:8]),
-			id:       binary.LittleEndian.Uint32(packet.Data[8:12]),
-			received: time.Now(),
-		}
+			record := newPacketTimestamp(header)
 
-		if !c.haveSeenPacket(&record) {
-			c.seenPackets = append(c.seenPackets, record)
+			if !c.haveSeenPacket(&record) {
+				c.seenPackets = append(c.seenPackets, record)
 
-			c.IncomingPackets <- packet
+				c.IncomingPackets <- packet
+			}
 		}
 
 	} else if transmitted, ok := msg.(*client.PacketTransmitted); ok {
@@ -281,13 +716,23 @@ func (c *MeshtasticClient) handleRadioMessage(msg client.ApiMessage) {
 		log.Warn("RX/TX timeout")
 	} else if rssi, ok := msg.(*client.ContinuoisRSSI); ok {
 		// Capture RSSI
+		c.detectCapability(func(capabilities *client.Capabilities) { capabilities.ContinuousRssi = true })
 		c.rssi_dBm.Store(int32(rssi.RSSI_dBm))
 		if c.continuousRssi {
 			c.Rssi <- int32(rssi.RSSI_dBm)
 		}
+	} else if deviceLog, ok := msg.(*client.DeviceLog); ok {
+		c.detectCapability(func(capabilities *client.Capabilities) { capabilities.Logging = true })
+		logDeviceMessage(log.With("source", "device"), deviceLog)
+		c.DeviceLogs <- deviceLog
 	}
 
 	if shouldSwitchToRx {
+		// Back to the configured channel after transmitting with overrides
+		if err := c.restoreTuning(); err != nil {
+			c.Errors <- err
+		}
+
 		// Switch back to RX mode
 		err := c.switchToRx()
 		if err != nil {
@@ -297,6 +742,30 @@ func (c *MeshtasticClient) handleRadioMessage(msg client.ApiMessage) {
 
 }
 
+func logDeviceMessage(logger *log.Logger, deviceLog *client.DeviceLog) {
+	switch deviceLog.Level {
+	case client.LOG_DEBUG:
+		logger.Debug(deviceLog.Text)
+	case client.LOG_INFO:
+		logger.Info(deviceLog.Text)
+	case client.LOG_WARNING:
+		logger.Warn(deviceLog.Text)
+	case client.LOG_ERROR:
+		logger.Error(deviceLog.Text)
+	default:
+		logger.With("level", deviceLog.Level).Info(deviceLog.Text)
+	}
+}
+
+func newPacketTimestamp(header *Header) PacketTimespamp {
+	return PacketTimespamp{
+		dest:     header.Dest,
+		from:     header.From,
+		id:       header.Id,
+		received: time.Now(),
+	}
+}
+
 func (c *MeshtasticClient) forgetOldSeenPackets() {
 	now := time.Now()
 
@@ -321,35 +790,123 @@ func (c *MeshtasticClient) haveSeenPacket(p *PacketTimespamp) bool {
 	return false
 }
 
-func (c *MeshtasticClient) transmitPacket(packet []byte) error {
-	// Purge records of older packets
-	c.forgetOldSeenPackets()
+/*
+Check whether the packet fits the airtime budget now. Packets that would
+exceed it are queued again once they fit, or rejected when the wait is too long.
+*/
+func (c *MeshtasticClient) checkAirtime(packet *RawPacket) bool {
+	if c.airtime == nil {
+		return true
+	}
+
+	now := time.Now()
+	timeOnAir := c.timeOnAir(packet)
+
+	delay, err := c.airtime.Delay(now, timeOnAir)
+	if err == nil && delay == 0 {
+		return true
+	}
+
+	if err == nil && delay <= c.airtimeMaxDelay {
+		log.With("timeOnAir", timeOnAir, "delay", delay).Warn("Airtime budget exhausted, packet delayed")
+
+		c.wg.Go(func() {
+			select {
+			case <-c.ctx.Done():
+			case <-time.After(delay):
+				select {
+				case <-c.ctx.Done():
+				case c.deferredPackets <- deferredPacket{packet: packet}:
+				}
+			}
+		})
+
+		return false
+	}
 
-	res, err := c.apiClient.SendRequest(&client.Transmit{Timeout_ms: 8000, Data: packet, Busy: false}, 5*time.Second)
+	rejection, ok := err.(*AirtimeExceededError)
+	if !ok {
+		rejection = &AirtimeExceededError{
+			TimeOnAir: timeOnAir,
+			Used:      c.airtime.Used(now),
+			Budget:    c.airtime.Budget(),
+			Window:    c.airtime.Window(),
+			Delay:     delay,
+		}
+	}
+	rejection.Size = len(packet.Data)
+
+	c.AirtimeRejections <- rejection
+
+	return false
+}
+
+func (c *MeshtasticClient) transmitPacket(outgoingPacket *RawPacket) error {
+	timeout, err := client.TransmitTimeout(c.timeOnAir(outgoingPacket))
 	if err != nil {
 		return err
 	}
 
+	if err := c.tune(outgoingPacket); err != nil {
+		return c.abortTransmission(err)
+	}
+
+	packet := outgoingPacket.Data
+
+	res, err := c.apiClient.SendRequest(&client.Transmit{Timeout_ms: timeout, Data: packet, Busy: false}, 5*time.Second)
+	if err != nil {
+		return c.abortTransmission(err)
+	}
+
 	tr, ok := res.(*client.Transmit)
 	if !ok {
-		return fmt.Errorf("invalid response to Transmit request")
+		return c.abortTransmission(fmt.Errorf("invalid response to Transmit request"))
 	} else {
 		if tr.Busy {
-			return &types.BusyError{}
+			return c.abortTransmission(&types.BusyError{})
 		}
 	}
 
-	// Add our own transmitted packet to avoid receiving the retransmissions
-	record := PacketTimespamp{
-		dest:     binary.BigEndian.Uint32(packet[0:4]),
-		from:     binary.BigEndian.Uint32(packet[4:8]),
-		id:       binary.LittleEndian.Uint32(packet[8:12]),
-		received: time.Now(),
+	if c.airtime != nil {
+		c.airtime.Record(time.Now(), c.timeOnAir(outgoingPacket))
+	}
+
+	if c.raw {
+		return nil
+	}
+
+	header, err := ParseHeader(packet)
+	if err != nil {
+		// Not a Meshtastic packet, nothing to remember
+		return nil
 	}
 
+	// Purge records of older packets
+	c.forgetOldSeenPackets()
+
+	// Add our own transmitted packet to avoid receiving the retransmissions
+	record := newPacketTimestamp(header)
+
 	if !c.haveSeenPacket(&record) {
 		c.seenPackets = append(c.seenPackets, record)
 	}
 
 	return nil
 }
+
+// Go back to the configured channel and to RX when the packet could not be transmitted.
+func (c *MeshtasticClient) abortTransmission(cause error) error {
+	if !c.retuned {
+		return cause
+	}
+
+	if err := c.restoreTuning(); err != nil {
+		c.Errors <- err
+	}
+
+	if err := c.switchToRx(); err != nil {
+		c.Errors <- err
+	}
+
+	return cause
+}
@@ -4,9 +4,16 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/emulator"
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
 	pb "github.com/meshtastic/go/generated"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/proto"
@@ -119,6 +126,8 @@ func TestReceivedPacketDecode(t *testing.T) {
 	assert.Equal(t, uint32(0xFb3EB15F), meshPacket.Id)
 	assert.Equal(t, uint32(7), meshPacket.HopLimit)
 	assert.Equal(t, uint32(7), meshPacket.HopStart)
+	assert.Equal(t, uint32(0), meshPacket.NextHop)
+	assert.Equal(t, uint32(0), meshPacket.RelayNode)
 
 	decoded, ok := meshPacket.PayloadVariant.(*pb.MeshPacket_Decoded)
 	assert.True(t, ok)
@@ -127,6 +136,32 @@ func TestReceivedPacketDecode(t *testing.T) {
 	assert.Equal(t, "Hello from Waveshare USB!", string(decoded.Decoded.Payload))
 }
 
+func TestPacketRelayRoundTrip(t *testing.T) {
+	channel := NewChannel(0, "LongFast", defaultPublicKey)
+
+	data, err := channel.EncodePacket(&pb.MeshPacket{
+		From:      0x11223344,
+		To:        0xFFFFFFFF,
+		Id:        0x01020304,
+		HopStart:  7,
+		HopLimit:  5,
+		NextHop:   0xAB,
+		RelayNode: 0x44,
+		PayloadVariant: &pb.MeshPacket_Decoded{
+			Decoded: &pb.Data{Portnum: pb.PortNum_TEXT_MESSAGE_APP, Payload: []byte("relayed")},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xAB, 0x44}, data[14:16])
+
+	meshPacket, err := channel.DecodePacket(&client.PacketReceived{Data: data})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0xAB), meshPacket.NextHop)
+	assert.Equal(t, uint32(0x44), meshPacket.RelayNode)
+	assert.Equal(t, uint32(5), meshPacket.HopLimit)
+	assert.Equal(t, uint32(7), meshPacket.HopStart)
+}
+
 /*
 Unhandled packet:
 ffffffffc049a09e26904befe36f00689e32c760d0d0ac27d1973466dfe26517bb32155cb5
@@ -145,3 +180,282 @@ ffffffffc4d03e430707355860920068c4fb16f4fa32a795e42fb805d391419c876cd7cf6184a6ba
 ffffffff978fd897b26eac4b615b0068e506707520ebc2dbdc1f7f3c29fae199140d39551c4049081deac99d7f160666e9
 ffffffffbcb6759e4b55acff61a50068d7dedda96e76c276f6e80816f1a8999938fbd43d31341ca4aa240d642ac832e2bb
 */
+
+/*
+Open a client on an emulated radio with the configuration, a default one when nil.
+The setup functions run before the client is open, both are closed with the test.
+*/
+func newEmulatedClient(t *testing.T, cfg *RadioConfiguration, setup ...func(*MeshtasticClient)) (*MeshtasticClient, *emulator.Radio) {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = &RadioConfiguration{
+			Frequency:       869525000,
+			Power:           14,
+			SpreadingFactor: client.LORA_SF11,
+			Bandwidth:       client.LORA_BW_250,
+			CodingRate:      client.LORA_CR_4_5,
+		}
+	}
+
+	host, device := client.NewPipeTransport()
+
+	radio := emulator.NewRadio()
+	if err := radio.Open(device); err != nil {
+		t.Fatalf("failed to open the emulated radio: %v", err)
+	}
+	t.Cleanup(func() { radio.Close() })
+
+	meshtasticClient := NewMeshtasticClient()
+	for _, f := range setup {
+		f(meshtasticClient)
+	}
+	t.Cleanup(func() { meshtasticClient.Close() })
+
+	if err := meshtasticClient.OpenTransport(host, cfg); err != nil {
+		t.Fatalf("failed to open the client: %v", err)
+	}
+
+	return meshtasticClient, radio
+}
+
+func TestMeshtasticClientWithEmulator(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           17,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+	})
+
+	assert.Equal(t, uint32(869525000), radio.Frequency())
+	assert.False(t, radio.LoRaParameters().LowDataRate)
+	assert.Equal(t, client.TxParameters{
+		DutyCycle: 0x02,
+		HpMax:     0x03,
+		Power:     22,
+		RampTime:  client.POWER_RAMP_80,
+	}, radio.TxParameters())
+	assert.Equal(t, client.LoRaPacketParameters{
+		PreambleLength: 16,
+		SyncWord:       0x2B,
+		CrcOn:          true,
+	}, radio.PacketParameters())
+	assert.True(t, radio.IsReceiving())
+
+	packet := []byte{
+		0xff, 0xff, 0xff, 0xff,
+		0x44, 0x33, 0x22, 0x11,
+		0x5f, 0xb1, 0x3e, 0xfb,
+		0xe7, 0x08, 0x00, 0x00,
+		0x7d, 0x7f, 0xa9, 0x49,
+	}
+
+	assert.NoError(t, radio.InjectPacket(packet, -80, 5))
+
+	select {
+	case received := <-meshtasticClient.IncomingPackets:
+		assert.Equal(t, packet, received.Data)
+		assert.Equal(t, int8(-80), received.PacketRSSI_dBm)
+	case <-time.After(time.Second):
+		t.Fatal("packet has not been received")
+	}
+
+	outgoing := []byte{
+		0xff, 0xff, 0xff, 0xff,
+		0x88, 0x77, 0x66, 0x55,
+		0x01, 0x02, 0x03, 0x04,
+		0xe7, 0x08, 0x00, 0x00,
+		0x01, 0x02,
+	}
+
+	meshtasticClient.OutgoingPackets <- outgoing
+
+	select {
+	case transmitted := <-radio.Transmitted:
+		assert.Equal(t, outgoing, transmitted)
+	case <-time.After(2 * time.Second):
+		t.Fatal("packet has not been transmitted")
+	}
+}
+
+func TestMeshtasticClientRxSettings(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+		RxBoost:         true,
+		FallbackMode:    client.FALLBACK_STANDBY_RC,
+	})
+
+	assert.True(t, radio.RxParameters().RxBoost)
+	assert.Equal(t, byte(client.FALLBACK_STANDBY_RC), radio.FallbackMode())
+
+	assert.NoError(t, meshtasticClient.SetRxBoost(false))
+	assert.NoError(t, meshtasticClient.SetFallbackMode(client.FALLBACK_STANDBY_XOSC_RX))
+
+	assert.False(t, radio.RxParameters().RxBoost)
+	assert.Equal(t, byte(client.FALLBACK_STANDBY_XOSC_RX), radio.FallbackMode())
+
+	rxBoost, fallbackMode := meshtasticClient.RxSettings()
+	assert.False(t, rxBoost)
+	assert.Equal(t, "standby_xosc_rx", fallbackMode.String())
+}
+
+func TestMeshtasticClientDisconnected(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, nil)
+
+	assert.NoError(t, meshtasticClient.Send([]byte{0x01}))
+
+	radio.Close()
+
+	select {
+	case state := <-meshtasticClient.Connection:
+		assert.False(t, state.Connected)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "disconnection is not reported")
+	}
+
+	// Nobody reads the errors, the loop must not get stuck
+	for range cap(meshtasticClient.Errors) + 1 {
+		meshtasticClient.OutgoingPackets <- []byte{0x02}
+	}
+
+	assert.IsType(t, &types.DisconnectedError{}, meshtasticClient.Send([]byte{0x03}))
+	assert.IsType(t, &types.DisconnectedError{}, meshtasticClient.SetRxBoost(true))
+}
+
+// Device end of a TCP connection, reads time out like a serial port
+type tcpDevice struct {
+	net.Conn
+}
+
+func (d *tcpDevice) Read(p []byte) (int, error) {
+	d.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	n, err := d.Conn.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, nil
+	}
+
+	return n, err
+}
+
+func TestMeshtasticClientReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// A new emulated device for every connection
+	radios := make(chan *emulator.Radio, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			radio := emulator.NewRadio()
+			radio.Open(&tcpDevice{Conn: conn})
+			radios <- radio
+		}
+	}()
+
+	meshtasticClient := NewMeshtasticClient()
+	assert.NoError(t, meshtasticClient.Open(client.TCP_PREFIX+listener.Addr().String(), &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+		ContinuousRssi:  true,
+	}))
+	defer meshtasticClient.Close()
+
+	(<-radios).Close()
+
+	for _, connected := range []bool{false, true} {
+		select {
+		case state := <-meshtasticClient.Connection:
+			assert.Equal(t, connected, state.Connected)
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "connection state is not reported")
+		}
+	}
+
+	radio := <-radios
+	defer radio.Close()
+
+	// The radio configuration is restored
+	assert.True(t, radio.IsReceiving())
+	assert.NoError(t, meshtasticClient.Send([]byte{0x01}))
+}
+
+func TestMeshtasticClientReplayEnds(t *testing.T) {
+	radioConfig := &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+	}
+
+	// Record the radio initialisation
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture, err := client.CreateCaptureFile(path)
+	assert.NoError(t, err)
+
+	recorder, _ := newEmulatedClient(t, radioConfig, func(c *MeshtasticClient) { c.SetCapture(capture) })
+	capture.Close()
+	recorder.Close()
+
+	replayClient := NewMeshtasticClient()
+	assert.NoError(t, replayClient.Open(client.REPLAY_PREFIX+path, radioConfig))
+	defer replayClient.Close()
+
+	select {
+	case state := <-replayClient.Connection:
+		assert.False(t, state.Connected)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "end of the replay is not reported")
+	}
+
+	// The capture is not played again
+	select {
+	case state := <-replayClient.Connection:
+		assert.Fail(t, "replay reconnected", "%+v", state)
+	case <-time.After(2 * RECONNECT_MIN_DELAY):
+	}
+}
+
+func TestMeshtasticClientDetectCapabilities(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, &RadioConfiguration{
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+		ContinuousRssi:  true,
+	})
+
+	assert.Equal(t, emulator.DEFAULT_VERSION, meshtasticClient.FirmwareVersion())
+
+	select {
+	case <-meshtasticClient.Rssi:
+	case <-time.After(time.Second):
+		assert.Fail(t, "continuous RSSI is not delivered")
+	}
+	assert.True(t, meshtasticClient.Capabilities().ContinuousRssi)
+	assert.False(t, meshtasticClient.Capabilities().Logging)
+
+	assert.NoError(t, radio.Log(client.LOG_WARNING, "low voltage"))
+
+	select {
+	case deviceLog := <-meshtasticClient.DeviceLogs:
+		assert.Equal(t, "low voltage", deviceLog.Text)
+	case <-time.After(time.Second):
+		assert.Fail(t, "device log is not delivered")
+	}
+	assert.True(t, meshtasticClient.Capabilities().Logging)
+}
@@ -3,6 +3,8 @@ package meshtastic
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"sync"
@@ -21,6 +23,65 @@ var defaultPublicKey = []byte{0xd4, 0xf1, 0xbb, 0x3a, 0x20, 0x29, 0x07, 0x59, 0x
 
 const defaultChannelName = "LongFast"
 
+type DeviceLogMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	Level     string `json:"level"`
+	Text      string `json:"text"`
+}
+
+type ConnectionStateMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	State     string `json:"state"`
+	Port      string `json:"port"`
+	Firmware  string `json:"firmware,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type AirtimeRejectionMessage struct {
+	Timestamp   int64  `json:"timestamp"`
+	Size        int    `json:"size"`
+	TimeOnAirMs int64  `json:"time_on_air_ms"`
+	UsedMs      int64  `json:"used_ms"`
+	BudgetMs    int64  `json:"budget_ms"`
+	WindowMs    int64  `json:"window_ms"`
+	Error       string `json:"error"`
+}
+
+type RadioControlMessage struct {
+	RxBoost      *bool   `json:"rx_boost,omitempty"`
+	FallbackMode *string `json:"fallback_mode,omitempty"`
+}
+
+type RadioControlReply struct {
+	RxBoost      bool   `json:"rx_boost"`
+	FallbackMode string `json:"fallback_mode"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Frame received in raw mode, the data is base64 encoded
+type RawPacketMessage struct {
+	Timestamp  int64  `json:"timestamp"`
+	Rssi       int8   `json:"rssi"`
+	Snr        int8   `json:"snr"`
+	SignalRssi int8   `json:"signal_rssi"`
+	Data       []byte `json:"data"`
+}
+
+// Frame to transmit in raw mode, zero overrides keep the configured values
+type RawTransmitMessage struct {
+	Data            []byte `json:"data"`
+	Frequency       uint32 `json:"frequency,omitempty"`
+	SpreadingFactor byte   `json:"spreading_factor,omitempty"`
+}
+
+// The radio fields describe the first radio, all of them are listed when there are several
+type NodeStatusMessage struct {
+	Id types.NodeId `json:"id"`
+	RadioStatusMessage
+
+	Radios []RadioStatusMessage `json:"radios,omitempty"`
+}
+
 type Node struct {
 	id         types.NodeId
 	shortName  string
@@ -33,11 +94,12 @@ type Node struct {
 	natsConn          *nats.Conn
 	natsSubjectPrefix string
 
-	channels    []*Channel
-	radioConfig RadioConfiguration
+	channels []*Channel
+	raw      bool
 
-	serialPortName   string
-	meshtasticClient *MeshtasticClient
+	radios          []*nodeRadio
+	bridges         []*bridge
+	incomingPackets chan radioPacket
 
 	retransmitForward  bool
 	retransmitPeriod   []types.Duration
@@ -68,17 +130,41 @@ func NewNode(port string, config *NodeConfiguration) *Node {
 		natsSubjectPrefix: config.NatsSubjectPrefix,
 
 		channels: []*Channel{},
+		raw:      config.IsRaw(),
 
-		radioConfig: config.Radio,
-
-		serialPortName:   port,
-		meshtasticClient: NewMeshtasticClient(),
+		incomingPackets: make(chan radioPacket, 10),
 
 		eventLoop: event_loop.NewEventLoop(),
 
 		packetIdGenerator: *types.NewPacketIdGenerator(16),
 	}
 
+	if len(config.Radios) == 0 {
+		radio := newNodeRadio("", port, config.Serial, config.Radio)
+		radio.natsSubjectPrefix = config.NatsSubjectPrefix
+		node.radios = append(node.radios, radio)
+	}
+
+	for _, rc := range config.Radios {
+		radioPort := rc.Port
+		if radioPort == "" {
+			radioPort = client.AUTO_PORT
+		}
+
+		radio := newNodeRadio(rc.Name, radioPort, rc.Serial, rc.Radio)
+		radio.channels = rc.Channels
+		radio.natsSubjectPrefix = fmt.Sprintf("%s.%s", config.NatsSubjectPrefix, rc.Name)
+		node.radios = append(node.radios, radio)
+	}
+
+	for _, radio := range node.radios {
+		radio.raw = node.raw
+	}
+
+	for _, bc := range config.Bridges {
+		node.bridges = append(node.bridges, node.newBridge(&bc))
+	}
+
 	if config.Retransmit != (*RetransmitConfiguration)(nil) {
 		node.retransmitForward = config.Retransmit.Forward
 		node.retransmitPeriod = config.Retransmit.Period
@@ -86,28 +172,50 @@ func NewNode(port string, config *NodeConfiguration) *Node {
 	}
 
 	for _, ch := range config.Channels {
-		key := ch.EncryptionKey
-		if len(key) == 1 && key[0] == 0x01 {
-			key = defaultPublicKey
-		}
-
 		node.channels = append(node.channels, NewChannel(
 			ch.Id,
 			ch.Name,
-			key,
+			ExpandChannelKey(ch.EncryptionKey),
 		))
 	}
 
 	return node
 }
 
+// Names of the radios, a single unnamed radio when the radios are not configured.
+func (n *Node) RadioNames() []string {
+	names := []string{}
+	for _, radio := range n.radios {
+		names = append(names, radio.name)
+	}
+
+	return names
+}
+
+// Record the serial traffic with the device of a radio into a capture file.
+func (n *Node) SetCapture(radioName string, capture *client.CaptureWriter) error {
+	for _, radio := range n.radios {
+		if radio.name == radioName {
+			radio.meshtasticClient.SetCapture(capture)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown radio '%s'", radioName)
+}
+
 func (n *Node) AddApplication(app Application) {
 	n.applications = append(n.applications, app)
 }
 
 func (n *Node) Start() error {
-	if err := n.meshtasticClient.Open(n.serialPortName, &n.radioConfig); err != nil {
-		return err
+	for i, radio := range n.radios {
+		if err := radio.open(); err != nil {
+			for _, opened := range n.radios[:i] {
+				opened.close()
+			}
+			return err
+		}
 	}
 
 	// Run the nats client
@@ -120,22 +228,52 @@ func (n *Node) Start() error {
 
 	n.ctx, n.cancel = context.WithCancel(context.Background())
 
+	// Reply to status requests
+	_, err = n.natsConn.Subscribe(fmt.Sprintf("%s.status", n.natsSubjectPrefix), func(msg *nats.Msg) {
+		jsonMessage, err := json.Marshal(n.status())
+		if err != nil {
+			log.With("err", err).Error("Failed to marshal status message")
+			return
+		}
+
+		msg.Respond(jsonMessage)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, radio := range n.radios {
+		if err := radio.run(n.ctx, &n.wg, n.natsConn, n.incomingPackets); err != nil {
+			return err
+		}
+	}
+
 	n.wg.Go(func() {
 	loop:
 		for {
 			select {
 			case <-n.ctx.Done():
 				break loop
-			case packet := <-n.meshtasticClient.IncomingPackets:
+			case received := <-n.incomingPackets:
+				radio, packet := received.radio, received.packet
+
+				if n.raw {
+					radio.publishRawPacket(packet)
+					continue
+				}
+
 				packetHandled := false
 				isForThisNode := false
 
 				log.With("packet", hex.EncodeToString(packet.Data)).Debug("Incoming")
 
+				var meshPacket *pb.MeshPacket
+
 				for _, channel := range n.channels {
-					meshPacket, err := channel.DecodePacket(packet)
+					decoded, err := channel.DecodePacket(packet)
 
-					if err == nil && meshPacket != nil {
+					if err == nil && decoded != nil {
+						meshPacket = decoded
 						isForThisNode = types.NodeId(meshPacket.To) == n.id
 						n.handlePacket(meshPacket)
 						packetHandled = true
@@ -150,46 +288,17 @@ func (n *Node) Start() error {
 				if !isForThisNode && n.retransmitForward {
 					// This is not out packet - retransmit it
 					n.eventLoop.Post(func(el event_loop.EventLoop) {
-						n.retransmitPacket(packet)
+						n.retransmitPacket(radio, packet)
 					}, time.Now().Add(time.Duration(1000+rand.Uint32N(n.retransmitJitterMs))*time.Millisecond))
 				}
-			}
-		}
-	})
 
-	// RSSI
-	n.wg.Go(func() {
-	loop:
-		for {
-			select {
-			case <-n.ctx.Done():
-				break loop
-			case rssi := <-n.meshtasticClient.Rssi:
-				if n.natsConn != nil {
-					n.natsConn.Publish(
-						fmt.Sprintf("%s.rssi", n.natsSubjectPrefix),
-						[]byte(fmt.Sprintf("{\"timestamp\":%d, \"rssi\": %d}", time.Now().UnixMilli(), rssi)),
-					)
+				if !isForThisNode {
+					n.bridgePacket(radio, packet, meshPacket)
 				}
 			}
 		}
 	})
 
-	// Log errors from Meshtastic client
-	n.wg.Go(func() {
-	loop:
-		for {
-			select {
-			case <-n.ctx.Done():
-				break loop
-			case err := <-n.meshtasticClient.Errors:
-				log.Error(err)
-			case err := <-n.meshtasticClient.Warnings:
-				log.Warn(err)
-			}
-		}
-	})
-
 	// Run the event loop
 	n.wg.Go(n.eventLoop.Run)
 
@@ -215,7 +324,29 @@ func (n *Node) Stop() error {
 	n.cancel()
 	n.wg.Wait()
 
-	return n.meshtasticClient.Close()
+	var err error
+	for _, radio := range n.radios {
+		if closeErr := radio.close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (n *Node) status() *NodeStatusMessage {
+	status := &NodeStatusMessage{
+		Id:                 n.id,
+		RadioStatusMessage: n.radios[0].status(),
+	}
+
+	if len(n.radios) > 1 {
+		for _, radio := range n.radios {
+			status.Radios = append(status.Radios, radio.status())
+		}
+	}
+
+	return status
 }
 
 func (n *Node) GetChannel(channelId uint32) *Channel {
@@ -250,6 +381,9 @@ func (n *Node) SendApplicationMessage(channelId uint32, destination types.NodeId
 		ViaMqtt:  false,
 		HopStart: 7,
 		HopLimit: 7,
+
+		// The sender is the first relay
+		RelayNode: uint32(LastByteOfNodeId(n.id)),
 		PayloadVariant: &pb.MeshPacket_Decoded{
 			Decoded: &pb.Data{
 				Portnum: portNum,
@@ -258,12 +392,27 @@ func (n *Node) SendApplicationMessage(channelId uint32, destination types.NodeId
 		},
 	}
 
+	radios := n.radiosForChannel(channelId)
+	if len(radios) == 0 {
+		return fmt.Errorf("no radio is used for channel id %d", channelId)
+	}
+
 	data, err := channel.EncodePacket(&meshPacket)
 	if err != nil {
 		return err
 	}
 
-	n.meshtasticClient.OutgoingPackets <- data
+	var sendErrors []error
+	for _, radio := range radios {
+		if err := radio.meshtasticClient.Send(data); err != nil {
+			sendErrors = append(sendErrors, radio.error(err))
+		}
+	}
+
+	if len(sendErrors) == len(radios) {
+		// Nothing went out, don't schedule retransmissions either
+		return errors.Join(sendErrors...)
+	}
 
 	log.With(
 		"channel", channelId,
@@ -276,7 +425,9 @@ func (n *Node) SendApplicationMessage(channelId uint32, destination types.NodeId
 	// Retransmit
 	for _, period := range n.retransmitPeriod {
 		n.eventLoop.Post(func(el event_loop.EventLoop) {
-			n.meshtasticClient.OutgoingPackets <- data
+			for _, radio := range radios {
+				radio.send(data)
+			}
 		}, time.Now().Add(time.Duration(period)).Add(time.Duration(rand.Uint32N(n.retransmitJitterMs*uint32(time.Millisecond)))))
 	}
 
@@ -296,6 +447,7 @@ func (n *Node) handlePacket(meshPacket *pb.MeshPacket) {
 		"From", fmt.Sprintf("%x", meshPacket.From),
 		"To", fmt.Sprintf("%x", meshPacket.To),
 		"Hops", meshPacket.HopStart-meshPacket.HopLimit,
+		"RelayNode", fmt.Sprintf("%02x", meshPacket.RelayNode),
 		"Channel", meshPacket.Channel,
 		"PortNum", decoded.Decoded.Portnum,
 	).Info("Received packet")
@@ -314,25 +466,53 @@ func (n *Node) handleUnknownPacket(packet *client.PacketReceived) {
 	log.With("packet", hex.EncodeToString(packet.Data)).Debug("Unhandled")
 }
 
-func (n *Node) retransmitPacket(packet *client.PacketReceived) {
-	flags := packet.Data[12]
-	hopLimit := flags & 0x07
+func (n *Node) retransmitPacket(radio *nodeRadio, packet *client.PacketReceived) {
+	data, ok := forwardedPacket(packet, LastByteOfNodeId(n.id))
+	if !ok {
+		return
+	}
+
+	radio.logger.Debug("Retransmitting incoming packet")
+
+	n.eventLoop.Post(func(el event_loop.EventLoop) {
+		radio.send(data)
+	}, time.Now().Add(time.Second))
+}
+
+/*
+Copy of a received packet with the hop limit decremented and this node
+as the relay, false when it is exhausted or the packet is malformed.
+*/
+func forwardedPacket(packet *client.PacketReceived, relayNode byte) ([]byte, bool) {
+	header, err := ParseHeader(packet.Data)
+	if err != nil {
+		return nil, false
+	}
+
+	hopLimit := header.HopLimit()
 
 	if hopLimit == 0 {
-		return
+		return nil, false
 	}
 
 	hopLimit -= 1
 
-	flags = (flags & 0xF8) | hopLimit
-
 	data := make([]byte, len(packet.Data))
 	copy(data, packet.Data)
-	data[12] = flags
+	data[12] = (header.Flags &^ FLAG_HOP_LIMIT_MASK) | byte(hopLimit)
+	data[15] = relayNode
 
-	log.Debug("Retransmitting incoming packet")
+	return data, true
+}
 
-	n.eventLoop.Post(func(el event_loop.EventLoop) {
-		n.meshtasticClient.OutgoingPackets <- data
-	}, time.Now().Add(time.Second))
+func (n *Node) radiosForChannel(channelId uint32) []*nodeRadio {
+	radios := []*nodeRadio{}
+
+	for _, radio := range n.radios {
+		if radio.carriesChannel(channelId) {
+			radios = append(radios, radio)
+		}
+	}
+
+	return radios
 }
@@ -1,12 +1,22 @@
 package meshtastic
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
 	"github.com/Archie3d/waveshare-usb-lora-client/pkg/types"
+	"github.com/charmbracelet/log"
+	pb "github.com/meshtastic/go/generated"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	NODE_MODE_MESHTASTIC = "meshtastic"
+	NODE_MODE_RAW        = "raw" // Arbitrary LoRa frames over NATS, no Meshtastic processing
+)
+
 // See https://dev.to/ilyakaznacheev/a-clean-way-to-pass-configs-in-a-go-application-1g64
 
 type NodeConfiguration struct {
@@ -17,11 +27,20 @@ type NodeConfiguration struct {
 	HwModel    uint32           `yaml:"hw_model"`
 	PublicKey  types.CryptoKey  `yaml:"public_key"`
 
+	Mode string `yaml:"mode,omitempty"`
+
 	NatsUrl           string `yaml:"nats_url"`
 	NatsSubjectPrefix string `yaml:"nats_subject_prefix"`
 
+	Serial *SerialConfiguration `yaml:"serial,omitempty"`
+
 	Radio RadioConfiguration `yaml:"radio"`
 
+	// Several radios instead of the single radio block
+	Radios []NodeRadioConfiguration `yaml:"radios,omitempty"`
+
+	Bridges []BridgeConfiguration `yaml:"bridges,omitempty"`
+
 	Channels []ChannelConfiguration `yaml:"channels"`
 
 	Retransmit *RetransmitConfiguration `yaml:"retransmit"`
@@ -33,13 +52,90 @@ type NodeConfiguration struct {
 	Position *PositionConfiguration `yaml:"position"`
 }
 
+type SerialConfiguration struct {
+	Vid          string `yaml:"vid,omitempty"`
+	Pid          string `yaml:"pid,omitempty"`
+	SerialNumber string `yaml:"serial_number,omitempty"`
+}
+
+// USB filter used to discover the device, nil when no serial block is configured
+func (s *SerialConfiguration) PortFilter() *client.PortFilter {
+	if s == nil {
+		return nil
+	}
+
+	return &client.PortFilter{Vid: s.Vid, Pid: s.Pid, SerialNumber: s.SerialNumber}
+}
+
 type RadioConfiguration struct {
+	Region          string              `yaml:"region,omitempty"`
+	Preset          string              `yaml:"preset,omitempty"`
+	FrequencySlot   uint32              `yaml:"frequency_slot,omitempty"`
 	Frequency       uint32              `yaml:"frequency"`
 	Power           LoRaPower           `yaml:"power"`
+	AntennaGain     int32               `yaml:"antenna_gain,omitempty"`
+	RampTime        *PowerRampTime      `yaml:"ramp_time,omitempty"`
 	SpreadingFactor LoRaSpreadingFactor `yaml:"spreading_factor"`
 	Bandwidth       LoRaBandwidth       `yaml:"bandwidth"`
 	CodingRate      LoRaCodingRate      `yaml:"coding_rate"`
+	LowDataRate     *bool               `yaml:"low_data_rate,omitempty"`
+	PreambleLength  uint16              `yaml:"preamble_length,omitempty"`
+	SyncWord        uint8               `yaml:"sync_word,omitempty"`
+	Crc             *bool               `yaml:"crc,omitempty"`
+	InvertIQ        bool                `yaml:"invert_iq,omitempty"`
 	ContinuousRssi  bool                `yaml:"continuous_rssi,omitempty"`
+	RxBoost         bool                `yaml:"rx_boost,omitempty"`
+	FallbackMode    LoRaFallbackMode    `yaml:"fallback_mode,omitempty"`
+
+	DutyCycle *DutyCycleConfiguration `yaml:"duty_cycle,omitempty"`
+
+	ListenBeforeTalk *ListenBeforeTalkConfiguration `yaml:"listen_before_talk,omitempty"`
+
+	// Whether the power was given, it has no default
+	powerConfigured bool
+}
+
+type NodeRadioConfiguration struct {
+	Name   string               `yaml:"name"`
+	Port   string               `yaml:"port,omitempty"`
+	Serial *SerialConfiguration `yaml:"serial,omitempty"`
+	Radio  RadioConfiguration   `yaml:"radio"`
+
+	// Ids of the channels used on this radio, all of them when empty
+	Channels []uint32 `yaml:"channels,omitempty"`
+}
+
+// Port or serial number identifying the device of the radio, empty when it is discovered.
+func (r *NodeRadioConfiguration) device() string {
+	if r.Port != "" && r.Port != client.AUTO_PORT {
+		return r.Port
+	}
+
+	if r.Serial != nil && r.Serial.SerialNumber != "" {
+		return "serial_number:" + r.Serial.SerialNumber
+	}
+
+	return ""
+}
+
+// Packets received on one radio and relayed on another, empty filters match everything
+type BridgeConfiguration struct {
+	From     string   `yaml:"from"`
+	To       string   `yaml:"to"`
+	Channels []uint32 `yaml:"channels,omitempty"`
+	PortNums []string `yaml:"port_nums,omitempty"`
+}
+
+type DutyCycleConfiguration struct {
+	Percent  float64        `yaml:"percent,omitempty"`
+	Window   types.Duration `yaml:"window,omitempty"`
+	MaxDelay types.Duration `yaml:"max_delay,omitempty"`
+}
+
+type ListenBeforeTalkConfiguration struct {
+	Threshold        int32          `yaml:"threshold,omitempty"`
+	ContentionWindow types.Duration `yaml:"contention_window,omitempty"`
+	MaxAttempts      int            `yaml:"max_attempts,omitempty"`
 }
 
 type RetransmitConfiguration struct {
@@ -77,18 +173,219 @@ type TelemetryDeviceMetricsConfiguration struct {
 }
 
 func LoadNodeConfiguration(configFile string) (*NodeConfiguration, error) {
-	f, err := os.Open(configFile)
+	data, err := os.ReadFile(configFile)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
 	config := &NodeConfiguration{}
-	decoder := yaml.NewDecoder(f)
-	err = decoder.Decode(config)
+	err = yaml.Unmarshal(data, config)
 	if err != nil {
 		return nil, err
 	}
 
+	switch config.Mode {
+	case "", NODE_MODE_MESHTASTIC, NODE_MODE_RAW:
+	default:
+		return nil, fmt.Errorf("unknown node mode '%s'", config.Mode)
+	}
+
+	if len(config.Radios) == 0 {
+		if err := config.resolveRadio(&config.Radio, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		if config.Radio != (RadioConfiguration{}) {
+			return nil, fmt.Errorf("either radio or radios can be configured, not both")
+		}
+
+		if config.Serial != nil {
+			return nil, fmt.Errorf("the serial filter of several radios is configured for each of them")
+		}
+
+		if err := config.resolveRadios(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.validateBridges(); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// Whether the node transports raw LoRa frames instead of Meshtastic packets.
+func (c *NodeConfiguration) IsRaw() bool {
+	return c.Mode == NODE_MODE_RAW
+}
+
+/*
+Work out the frequency from the region and validate the radio settings.
+The channels are the ids used on the radio, all of them when empty.
+*/
+func (c *NodeConfiguration) resolveRadio(radio *RadioConfiguration, channels []uint32) error {
+	if !radio.powerConfigured {
+		return fmt.Errorf("radio power is not configured")
+	}
+
+	if radio.Region != "" && radio.Frequency == 0 {
+		frequency, err := c.slotFrequency(radio, channels)
+		if err != nil {
+			return err
+		}
+		radio.Frequency = frequency
+	}
+
+	// Also catches a missing frequency when there is no region to work it out
+	if err := client.CheckFrequency(radio.Frequency); err != nil {
+		return fmt.Errorf("invalid radio configuration: %w", err)
+	}
+
+	if radio.Region != "" {
+		if err := radio.Validate(); err != nil {
+			return fmt.Errorf("invalid radio configuration: %w", err)
+		}
+	} else {
+		log.Warn("Radio region is not configured, regulatory limits are not checked")
+	}
+
+	return nil
+}
+
+func (c *NodeConfiguration) resolveRadios() error {
+	names := map[string]bool{}
+	devices := map[string]bool{}
+
+	for i := range c.Radios {
+		r := &c.Radios[i]
+
+		if r.Name == "" {
+			return fmt.Errorf("radio %d has no name", i)
+		}
+
+		if names[r.Name] {
+			return fmt.Errorf("duplicate radio name '%s'", r.Name)
+		}
+		names[r.Name] = true
+
+		// Radios discovered without a filter of their own would all pick the same device
+		device := r.device()
+		if len(c.Radios) > 1 {
+			if device == "" {
+				return fmt.Errorf("radio '%s' needs a port or a serial number", r.Name)
+			}
+
+			if devices[device] {
+				return fmt.Errorf("radio '%s' uses the same device as another radio", r.Name)
+			}
+			devices[device] = true
+		}
+
+		if err := c.resolveRadio(&r.Radio, r.Channels); err != nil {
+			return fmt.Errorf("radio '%s': %w", r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *NodeConfiguration) validateBridges() error {
+	for _, b := range c.Bridges {
+		if c.findRadio(b.From) == nil {
+			return fmt.Errorf("bridge from unknown radio '%s'", b.From)
+		}
+
+		if c.findRadio(b.To) == nil {
+			return fmt.Errorf("bridge to unknown radio '%s'", b.To)
+		}
+
+		if b.From == b.To {
+			return fmt.Errorf("radio '%s' is bridged to itself", b.From)
+		}
+
+		for _, name := range b.PortNums {
+			if _, err := parsePortNum(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *NodeConfiguration) findRadio(name string) *NodeRadioConfiguration {
+	for i := range c.Radios {
+		if c.Radios[i].Name == name {
+			return &c.Radios[i]
+		}
+	}
+
+	return nil
+}
+
+// Port number by its name (e.g. TEXT_MESSAGE_APP) or value.
+func parsePortNum(name string) (pb.PortNum, error) {
+	if value, ok := pb.PortNum_value[name]; ok {
+		return pb.PortNum(value), nil
+	}
+
+	value, err := strconv.ParseInt(name, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown port number '%s'", name)
+	}
+
+	return pb.PortNum(value), nil
+}
+
+/*
+Radio frequency of the configured region frequency slot.
+When no slot is given, it is derived from the primary channel name
+the same way the Meshtastic firmware does it.
+*/
+func (c *NodeConfiguration) slotFrequency(radio *RadioConfiguration, channels []uint32) (uint32, error) {
+	region, err := LookupRegion(radio.Region)
+	if err != nil {
+		return 0, err
+	}
+
+	bandwidth := byte(radio.Bandwidth)
+	slots := region.FrequencySlots(bandwidth)
+
+	if radio.FrequencySlot > 0 {
+		if radio.FrequencySlot > slots {
+			return 0, fmt.Errorf("frequency slot %d is out of range, %s region has %d slots", radio.FrequencySlot, region.Name, slots)
+		}
+		return region.SlotFrequency(bandwidth, radio.FrequencySlot-1), nil
+	}
+
+	slot, err := region.DefaultFrequencySlot(bandwidth, c.primaryChannelName(radio, channels))
+	if err != nil {
+		return 0, err
+	}
+
+	return region.SlotFrequency(bandwidth, slot), nil
+}
+
+/*
+Name of the primary channel of the radio: the first of its channels, or the channel 0
+when it uses all of them. The firmware uses the preset name for unnamed channels.
+*/
+func (c *NodeConfiguration) primaryChannelName(radio *RadioConfiguration, channels []uint32) string {
+	primary := uint32(0)
+	if len(channels) > 0 {
+		primary = channels[0]
+	}
+
+	for _, channel := range c.Channels {
+		if channel.Id == primary && channel.Name != "" {
+			return channel.Name
+		}
+	}
+
+	if preset, err := LookupModemPreset(radio.Preset); err == nil {
+		return preset.DisplayName
+	}
+
+	return ""
+}
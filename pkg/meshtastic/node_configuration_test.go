@@ -34,4 +34,109 @@ func TestLoadNodeConfigYaml(t *testing.T) {
 	assert.Equal(t, 11, int(cfg.Radio.SpreadingFactor))
 	assert.Equal(t, client.LORA_BW_250, int(cfg.Radio.Bandwidth))
 	assert.Equal(t, client.LORA_CR_4_5, int(cfg.Radio.CodingRate))
+
+	packetParams := cfg.Radio.PacketParameters()
+	assert.Equal(t, uint16(16), packetParams.PreambleLength)
+	assert.Equal(t, byte(0x2B), packetParams.SyncWord)
+	assert.True(t, packetParams.CrcOn)
+	assert.False(t, packetParams.InvertIQ)
+}
+
+func TestRadioConfigurationLowDataRate(t *testing.T) {
+	// LongFast
+	cfg := RadioConfiguration{
+		SpreadingFactor: client.LORA_SF11,
+		Bandwidth:       client.LORA_BW_250,
+		CodingRate:      client.LORA_CR_4_5,
+	}
+	assert.False(t, cfg.LoRaParameters().LowDataRate)
+
+	// LongSlow
+	cfg.Bandwidth = client.LORA_BW_125
+	assert.True(t, cfg.LoRaParameters().LowDataRate)
+
+	override := false
+	cfg.LowDataRate = &override
+	assert.False(t, cfg.LoRaParameters().LowDataRate)
+}
+
+func TestLoadNodeConfigPreset(t *testing.T) {
+	cfg, err := LoadNodeConfiguration(filepath.Join("testdata", "preset_config.yaml"))
+
+	assert.NoError(t, err)
+
+	// Preset values
+	assert.Equal(t, client.LORA_SF9, int(cfg.Radio.SpreadingFactor))
+	assert.Equal(t, client.LORA_BW_250, int(cfg.Radio.Bandwidth))
+
+	// Explicit value takes precedence over the preset
+	assert.Equal(t, client.LORA_CR_4_8, int(cfg.Radio.CodingRate))
+
+	// Slot derived from the preset name of the unnamed primary channel
+	assert.Equal(t, uint32(913125000), cfg.Radio.Frequency)
+
+	txParams, err := cfg.Radio.TxParameters()
+	assert.NoError(t, err)
+	// -5 dBm with the 14 dBm PA configuration
+	assert.Equal(t, byte(0x02), txParams.HpMax)
+	assert.Equal(t, byte(3), txParams.Power)
+	assert.Equal(t, byte(client.POWER_RAMP_200), txParams.RampTime)
+
+	assert.True(t, cfg.Radio.RxBoost)
+	assert.Equal(t, LoRaFallbackMode(client.FALLBACK_STANDBY_RC), cfg.Radio.FallbackMode)
+}
+
+func TestLoadNodeConfigRadios(t *testing.T) {
+	cfg, err := LoadNodeConfiguration(filepath.Join("testdata", "radios_config.yaml"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cfg.Radios))
+
+	longFast := cfg.Radios[0]
+	assert.Equal(t, "longfast", longFast.Name)
+	assert.Equal(t, "/dev/ttyUSB0", longFast.Port)
+	assert.Equal(t, []uint32{0}, longFast.Channels)
+	assert.Equal(t, client.LORA_SF11, int(longFast.Radio.SpreadingFactor))
+	assert.Equal(t, uint32(869525000), longFast.Radio.Frequency)
+
+	private := cfg.Radios[1]
+	assert.Equal(t, "5A2B0012", private.Serial.SerialNumber)
+	assert.Equal(t, client.LORA_SF9, int(private.Radio.SpreadingFactor))
+	assert.Equal(t, uint32(869525000), private.Radio.Frequency)
+
+	assert.Equal(t, []BridgeConfiguration{
+		{From: "longfast", To: "private", PortNums: []string{"TEXT_MESSAGE_APP"}},
+		{From: "private", To: "longfast", Channels: []uint32{1}},
+	}, cfg.Bridges)
+}
+
+func TestLoadNodeConfigRadioChannels(t *testing.T) {
+	cfg, err := LoadNodeConfiguration(filepath.Join("testdata", "radios_channels_config.yaml"))
+
+	assert.NoError(t, err)
+
+	// Slots derived from the "LongFast" and "Private" channel names
+	assert.Equal(t, uint32(906875000), cfg.Radios[0].Radio.Frequency)
+	assert.Equal(t, uint32(914125000), cfg.Radios[1].Radio.Frequency)
+}
+
+func TestLoadNodeConfigRadioDevices(t *testing.T) {
+	// Both radios would discover the same device
+	_, err := LoadNodeConfiguration(filepath.Join("testdata", "radios_no_port_config.yaml"))
+	assert.ErrorContains(t, err, "radio 'private' needs a port or a serial number")
+
+	// Node level serial filter is ignored with several radios
+	_, err = LoadNodeConfiguration(filepath.Join("testdata", "radios_serial_config.yaml"))
+	assert.Error(t, err)
+}
+
+func TestLoadNodeConfigWithoutPower(t *testing.T) {
+	_, err := LoadNodeConfiguration(filepath.Join("testdata", "no_power_config.yaml"))
+	assert.ErrorContains(t, err, "power is not configured")
+}
+
+func TestLoadNodeConfigWithoutFrequency(t *testing.T) {
+	// Without a region there is nothing to work out the frequency from
+	_, err := LoadNodeConfiguration(filepath.Join("testdata", "no_frequency_config.yaml"))
+	assert.ErrorContains(t, err, "outside of the 150-960 MHz range")
 }
@@ -0,0 +1,400 @@
+package meshtastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/charmbracelet/log"
+	"github.com/nats-io/nats.go"
+)
+
+type RadioStatusMessage struct {
+	Name         string                `json:"name,omitempty"`
+	Connected    bool                  `json:"connected"`
+	Port         string                `json:"port"`
+	Firmware     string                `json:"firmware"`
+	Capabilities client.Capabilities   `json:"capabilities"`
+	Stats        client.ApiClientStats `json:"stats"`
+
+	ListenBeforeTalk ListenBeforeTalkStats `json:"listen_before_talk"`
+}
+
+// Device of the node, with its own radio settings and NATS subjects
+type nodeRadio struct {
+	name     string
+	portName string
+	config   RadioConfiguration
+	raw      bool
+	logger   *log.Logger
+
+	// Ids of the channels used on this radio, all of them when empty
+	channels []uint32
+
+	natsConn          *nats.Conn
+	natsSubjectPrefix string
+
+	meshtasticClient *MeshtasticClient
+
+	connectionMutex sync.Mutex
+	connection      ConnectionState
+}
+
+// Packet received by one of the radios
+type radioPacket struct {
+	radio  *nodeRadio
+	packet *client.PacketReceived
+}
+
+func newNodeRadio(name string, port string, serial *SerialConfiguration, config RadioConfiguration) *nodeRadio {
+	r := &nodeRadio{
+		name:             name,
+		portName:         port,
+		config:           config,
+		logger:           log.Default(),
+		meshtasticClient: NewMeshtasticClient(),
+	}
+
+	if name != "" {
+		r.logger = log.With("radio", name)
+	}
+
+	if serial != nil {
+		r.meshtasticClient.SetPortFilter(serial.PortFilter())
+	}
+
+	return r
+}
+
+func (r *nodeRadio) carriesChannel(channelId uint32) bool {
+	return len(r.channels) == 0 || slices.Contains(r.channels, channelId)
+}
+
+func (r *nodeRadio) open() error {
+	r.meshtasticClient.SetRawMode(r.raw)
+
+	if err := r.meshtasticClient.Open(r.portName, &r.config); err != nil {
+		return r.error(err)
+	}
+
+	return nil
+}
+
+// Name the radio in errors when there are several of them.
+func (r *nodeRadio) error(err error) error {
+	if r.name != "" {
+		return fmt.Errorf("radio '%s': %w", r.name, err)
+	}
+	return err
+}
+
+// Queue a packet for transmission, failures are only logged.
+func (r *nodeRadio) send(data []byte) {
+	if err := r.meshtasticClient.Send(data); err != nil {
+		r.logger.With("err", err).Warn("Packet not sent")
+	}
+}
+
+func (r *nodeRadio) close() error {
+	return r.meshtasticClient.Close()
+}
+
+// Publish the radio state on NATS and pass the received packets on.
+func (r *nodeRadio) run(ctx context.Context, wg *sync.WaitGroup, natsConn *nats.Conn, incoming chan<- radioPacket) error {
+	r.natsConn = natsConn
+
+	r.publishConnectionState(ConnectionState{
+		Connected: true,
+		Port:      r.meshtasticClient.PortName(),
+		Firmware:  r.meshtasticClient.FirmwareVersion(),
+	})
+
+	// Change radio settings at runtime
+	_, err := r.natsConn.Subscribe(fmt.Sprintf("%s.radio.control", r.natsSubjectPrefix), func(msg *nats.Msg) {
+		jsonMessage, err := json.Marshal(r.controlRadio(msg.Data))
+		if err != nil {
+			r.logger.With("err", err).Error("Failed to marshal radio control reply")
+			return
+		}
+
+		msg.Respond(jsonMessage)
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.raw {
+		// Transmit frames as-is
+		_, err = r.natsConn.Subscribe(fmt.Sprintf("%s.raw.out", r.natsSubjectPrefix), r.transmitRawPacket)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Received packets
+	wg.Go(func() {
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case packet := <-r.meshtasticClient.IncomingPackets:
+				select {
+				case <-ctx.Done():
+					break loop
+				case incoming <- radioPacket{radio: r, packet: packet}:
+				}
+			}
+		}
+	})
+
+	// RSSI
+	wg.Go(func() {
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case rssi := <-r.meshtasticClient.Rssi:
+				r.natsConn.Publish(
+					fmt.Sprintf("%s.rssi", r.natsSubjectPrefix),
+					[]byte(fmt.Sprintf("{\"timestamp\":%d, \"rssi\": %d}", time.Now().UnixMilli(), rssi)),
+				)
+			}
+		}
+	})
+
+	// Device logs
+	wg.Go(func() {
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case deviceLog := <-r.meshtasticClient.DeviceLogs:
+				r.publishDeviceLog(deviceLog)
+			}
+		}
+	})
+
+	// Device connection state
+	wg.Go(func() {
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case state := <-r.meshtasticClient.Connection:
+				r.publishConnectionState(state)
+			}
+		}
+	})
+
+	// Packets rejected by the duty cycle limiter
+	wg.Go(func() {
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case rejection := <-r.meshtasticClient.AirtimeRejections:
+				r.logger.With("err", rejection).Warn("Outgoing packet rejected")
+				r.publishAirtimeRejection(rejection)
+			}
+		}
+	})
+
+	// Log errors from Meshtastic client
+	wg.Go(func() {
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case err := <-r.meshtasticClient.Errors:
+				r.logger.Error(err)
+			case err := <-r.meshtasticClient.Warnings:
+				r.logger.Warn(err)
+			}
+		}
+	})
+
+	return nil
+}
+
+func (r *nodeRadio) status() RadioStatusMessage {
+	r.connectionMutex.Lock()
+	connection := r.connection
+	r.connectionMutex.Unlock()
+
+	return RadioStatusMessage{
+		Name:         r.name,
+		Connected:    connection.Connected,
+		Port:         connection.Port,
+		Firmware:     r.meshtasticClient.FirmwareVersion().String(),
+		Capabilities: r.meshtasticClient.Capabilities(),
+		Stats:        r.meshtasticClient.Stats(),
+
+		ListenBeforeTalk: r.meshtasticClient.ListenBeforeTalkStats(),
+	}
+}
+
+func (r *nodeRadio) publishDeviceLog(deviceLog *client.DeviceLog) {
+	jsonMessage, err := json.Marshal(&DeviceLogMessage{
+		Timestamp: time.Now().UnixMilli(),
+		Level:     deviceLog.LevelName(),
+		Text:      deviceLog.Text,
+	})
+
+	if err != nil {
+		r.logger.With("err", err).Error("Failed to marshal device log message")
+		return
+	}
+
+	r.natsConn.Publish(fmt.Sprintf("%s.device.log", r.natsSubjectPrefix), jsonMessage)
+}
+
+func (r *nodeRadio) publishAirtimeRejection(rejection *AirtimeExceededError) {
+	jsonMessage, err := json.Marshal(&AirtimeRejectionMessage{
+		Timestamp:   time.Now().UnixMilli(),
+		Size:        rejection.Size,
+		TimeOnAirMs: rejection.TimeOnAir.Milliseconds(),
+		UsedMs:      rejection.Used.Milliseconds(),
+		BudgetMs:    rejection.Budget.Milliseconds(),
+		WindowMs:    rejection.Window.Milliseconds(),
+		Error:       rejection.Error(),
+	})
+
+	if err != nil {
+		r.logger.With("err", err).Error("Failed to marshal airtime rejection message")
+		return
+	}
+
+	r.natsConn.Publish(fmt.Sprintf("%s.airtime.rejected", r.natsSubjectPrefix), jsonMessage)
+}
+
+func (r *nodeRadio) publishConnectionState(state ConnectionState) {
+	r.connectionMutex.Lock()
+	r.connection = state
+	r.connectionMutex.Unlock()
+
+	message := ConnectionStateMessage{
+		Timestamp: time.Now().UnixMilli(),
+		State:     "disconnected",
+		Port:      state.Port,
+	}
+
+	if state.Connected {
+		message.State = "connected"
+		message.Firmware = state.Firmware.String()
+	}
+
+	if state.Err != nil {
+		message.Error = state.Err.Error()
+	}
+
+	jsonMessage, err := json.Marshal(&message)
+	if err != nil {
+		r.logger.With("err", err).Error("Failed to marshal connection state message")
+		return
+	}
+
+	r.natsConn.Publish(fmt.Sprintf("%s.connection", r.natsSubjectPrefix), jsonMessage)
+}
+
+func (r *nodeRadio) publishRawPacket(packet *client.PacketReceived) {
+	r.logger.With(
+		"rssi", packet.PacketRSSI_dBm,
+		"snr", packet.PacketSNR_dB,
+		"size", len(packet.Data),
+	).Info("Received raw packet")
+
+	jsonMessage, err := json.Marshal(&RawPacketMessage{
+		Timestamp:  time.Now().UnixMilli(),
+		Rssi:       packet.PacketRSSI_dBm,
+		Snr:        packet.PacketSNR_dB,
+		SignalRssi: packet.SignalRSSI_dBm,
+		Data:       packet.Data,
+	})
+
+	if err != nil {
+		r.logger.With("err", err).Error("Failed to marshal raw packet message")
+		return
+	}
+
+	r.natsConn.Publish(fmt.Sprintf("%s.raw.in", r.natsSubjectPrefix), jsonMessage)
+}
+
+func (r *nodeRadio) transmitRawPacket(msg *nats.Msg) {
+	var message RawTransmitMessage
+	if err := json.Unmarshal(msg.Data, &message); err != nil {
+		r.logger.With("err", err).Warn("Invalid raw packet message")
+		return
+	}
+
+	if len(message.Data) == 0 {
+		r.logger.Warn("Raw packet message has no data")
+		return
+	}
+
+	r.logger.With(
+		"size", len(message.Data),
+		"frequency", message.Frequency,
+		"spreadingFactor", message.SpreadingFactor,
+	).Info("Outgoing raw packet")
+
+	err := r.meshtasticClient.SendRaw(&RawPacket{
+		Data:            message.Data,
+		Frequency_Hz:    message.Frequency,
+		SpreadingFactor: message.SpreadingFactor,
+	})
+	if err != nil {
+		r.logger.With("err", err).Warn("Raw packet not sent")
+	}
+}
+
+func (r *nodeRadio) controlRadio(data []byte) *RadioControlReply {
+	reply := &RadioControlReply{}
+
+	var control RadioControlMessage
+	err := json.Unmarshal(data, &control)
+	if err == nil {
+		err = r.applyRadioControl(&control)
+	}
+
+	if err != nil {
+		r.logger.With("err", err).Warn("Radio control failed")
+		reply.Error = err.Error()
+	}
+
+	rxBoost, fallbackMode := r.meshtasticClient.RxSettings()
+	reply.RxBoost = rxBoost
+	reply.FallbackMode = fallbackMode.String()
+
+	return reply
+}
+
+func (r *nodeRadio) applyRadioControl(control *RadioControlMessage) error {
+	if control.FallbackMode != nil {
+		mode, err := ParseFallbackMode(*control.FallbackMode)
+		if err != nil {
+			return err
+		}
+
+		if err := r.meshtasticClient.SetFallbackMode(mode); err != nil {
+			return err
+		}
+	}
+
+	if control.RxBoost != nil {
+		if err := r.meshtasticClient.SetRxBoost(*control.RxBoost); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package meshtastic
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeCapture(t *testing.T) {
+	cfg, err := LoadNodeConfiguration(filepath.Join("testdata", "radios_config.yaml"))
+	assert.NoError(t, err)
+
+	node := NewNode("", cfg)
+	assert.Equal(t, []string{"longfast", "private"}, node.RadioNames())
+
+	capture := client.NewCaptureWriter(io.Discard)
+	assert.NoError(t, node.SetCapture("private", capture))
+	assert.Error(t, node.SetCapture("missing", capture))
+}
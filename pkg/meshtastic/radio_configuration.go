@@ -8,6 +8,12 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	// Meshtastic LoRa packet parameters
+	MESHTASTIC_PREAMBLE_LENGTH = 16
+	MESHTASTIC_SYNC_WORD       = 0x2B
+)
+
 type LoRaBandwidth uint32
 
 func (b LoRaBandwidth) MarshalYAML() (any, error) {
@@ -127,11 +133,216 @@ func (s *LoRaPower) UnmarshalYAML(node *yaml.Node) error {
 		return err
 	}
 
-	if pw != 14 && pw != 17 && pw != 20 && pw != 22 {
-		return fmt.Errorf("unsupported LoRa power %d", pw)
+	if pw < client.MIN_TX_POWER || pw > client.MAX_TX_POWER {
+		return fmt.Errorf("unsupported LoRa power %d, expected [%d, %d] dBm", pw, client.MIN_TX_POWER, client.MAX_TX_POWER)
 	}
 
 	*s = LoRaPower(pw)
 
 	return nil
 }
+
+//------------------------------------------------------------------------------
+
+// Mode the radio falls back to after a transmission or a reception.
+type LoRaFallbackMode uint32
+
+var fallbackModes = []struct {
+	name string
+	mode LoRaFallbackMode
+}{
+	{"standby_rc", client.FALLBACK_STANDBY_RC},
+	{"standby_xosc", client.FALLBACK_STANDBY_XOSC},
+	{"standby_xosc_rx", client.FALLBACK_STANDBY_XOSC_RX},
+	{"fs", client.FALLBACK_FS},
+}
+
+func ParseFallbackMode(name string) (LoRaFallbackMode, error) {
+	for _, fm := range fallbackModes {
+		if fm.name == name {
+			return fm.mode, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown fallback mode '%s'", name)
+}
+
+// Configured mode, the radio returns to RX by default.
+func (m LoRaFallbackMode) OrDefault() LoRaFallbackMode {
+	if m == 0 {
+		return client.FALLBACK_STANDBY_XOSC_RX
+	}
+
+	return m
+}
+
+func (m LoRaFallbackMode) String() string {
+	for _, fm := range fallbackModes {
+		if fm.mode == m {
+			return fm.name
+		}
+	}
+
+	return fmt.Sprintf("0x%02X", uint32(m))
+}
+
+func (m LoRaFallbackMode) MarshalYAML() (any, error) {
+	return m.String(), nil
+}
+
+func (m *LoRaFallbackMode) UnmarshalYAML(node *yaml.Node) error {
+	mode, err := ParseFallbackMode(node.Value)
+	if err != nil {
+		return err
+	}
+
+	*m = mode
+
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// Power amplifier ramp time, in microseconds in YAML.
+type PowerRampTime uint32
+
+var powerRampTimes = []struct {
+	us   uint64
+	ramp PowerRampTime
+}{
+	{10, client.POWER_RAMP_10},
+	{20, client.POWER_RAMP_20},
+	{40, client.POWER_RAMP_40},
+	{80, client.POWER_RAMP_80},
+	{200, client.POWER_RAMP_200},
+	{800, client.POWER_RAMP_800},
+	{1700, client.POWER_RAMP_1700},
+	{3400, client.POWER_RAMP_3400},
+}
+
+func (r PowerRampTime) MarshalYAML() (any, error) {
+	for _, rt := range powerRampTimes {
+		if rt.ramp == r {
+			return rt.us, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported power ramp time: %d", uint32(r))
+}
+
+func (r *PowerRampTime) UnmarshalYAML(node *yaml.Node) error {
+	us, err := strconv.ParseUint(node.Value, 10, 32)
+	if err != nil {
+		return err
+	}
+
+	for _, rt := range powerRampTimes {
+		if rt.us == us {
+			*r = rt.ramp
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported power ramp time %d us", us)
+}
+
+//------------------------------------------------------------------------------
+
+// Modem preset values are applied first, so that explicit values take precedence.
+func (r *RadioConfiguration) UnmarshalYAML(node *yaml.Node) error {
+	type plain RadioConfiguration
+
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+
+	// 0 dBm is a valid power, tell it apart from a missing value
+	r.powerConfigured = hasKey(node, "power")
+
+	if r.Preset == "" {
+		return nil
+	}
+
+	preset, err := LookupModemPreset(r.Preset)
+	if err != nil {
+		return err
+	}
+
+	// Decode again on top of the preset
+	*r = RadioConfiguration{
+		SpreadingFactor: LoRaSpreadingFactor(preset.SpreadingFactor),
+		Bandwidth:       LoRaBandwidth(preset.Bandwidth),
+		CodingRate:      LoRaCodingRate(preset.CodingRate),
+		powerConfigured: r.powerConfigured,
+	}
+
+	return node.Decode((*plain)(r))
+}
+
+func hasKey(node *yaml.Node, key string) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TX parameters for the configured power, the ramp time defaults to 80 us.
+func (r *RadioConfiguration) TxParameters() (*client.TxParameters, error) {
+	var rampTime byte = client.POWER_RAMP_80
+	if r.RampTime != nil {
+		rampTime = byte(*r.RampTime)
+	}
+
+	return client.TxParametersForPower(int(r.Power), rampTime)
+}
+
+/*
+LoRa modulation parameters. The low data rate optimisation is enabled
+when the symbol duration requires it, unless overridden by the configuration.
+*/
+func (r *RadioConfiguration) LoRaParameters() client.LoRaParameters {
+	params := client.LoRaParameters{
+		SpreadingFactor: byte(r.SpreadingFactor),
+		Bandwidth:       byte(r.Bandwidth),
+		CodingRate:      byte(r.CodingRate),
+		LowDataRate:     client.LowDataRateRequired(byte(r.SpreadingFactor), byte(r.Bandwidth)),
+	}
+
+	if r.LowDataRate != nil {
+		params.LowDataRate = *r.LowDataRate
+	}
+
+	return params
+}
+
+// LoRa packet parameters, Meshtastic defaults are used for the values not configured.
+func (r *RadioConfiguration) PacketParameters() client.LoRaPacketParameters {
+	params := client.LoRaPacketParameters{
+		PreambleLength: r.PreambleLength,
+		ImplicitHeader: false,
+		SyncWord:       r.SyncWord,
+		CrcOn:          true,
+		InvertIQ:       r.InvertIQ,
+	}
+
+	if params.PreambleLength == 0 {
+		params.PreambleLength = MESHTASTIC_PREAMBLE_LENGTH
+	}
+
+	if params.SyncWord == 0 {
+		params.SyncWord = MESHTASTIC_SYNC_WORD
+	}
+
+	if r.Crc != nil {
+		params.CrcOn = *r.Crc
+	}
+
+	return params
+}
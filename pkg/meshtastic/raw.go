@@ -0,0 +1,97 @@
+package meshtastic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+// Frame to transmit as-is, zero overrides keep the configured values.
+type RawPacket struct {
+	Data            []byte
+	Frequency_Hz    uint32
+	SpreadingFactor byte
+}
+
+func (p *RawPacket) hasOverrides() bool {
+	return p.Frequency_Hz != 0 || p.SpreadingFactor != 0
+}
+
+/*
+In raw mode every received packet is delivered without the Meshtastic
+duplicate filtering, so frames of any format and length can be handled.
+Must be set before opening the client.
+*/
+func (c *MeshtasticClient) SetRawMode(enabled bool) {
+	c.raw = enabled
+}
+
+// Check that the packet overrides are valid for the configured region.
+func (c *MeshtasticClient) checkOverrides(packet *RawPacket) error {
+	if packet.SpreadingFactor != 0 && (packet.SpreadingFactor < client.LORA_SF5 || packet.SpreadingFactor > client.LORA_SF12) {
+		return fmt.Errorf("unsupported LoRa spreading factor %d", packet.SpreadingFactor)
+	}
+
+	if packet.Frequency_Hz != 0 && c.radioConfig.Region != "" {
+		if _, err := LookupBand(c.radioConfig.Region, packet.Frequency_Hz, byte(c.radioConfig.Bandwidth)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *MeshtasticClient) frequencyFor(packet *RawPacket) uint32 {
+	if packet.Frequency_Hz != 0 {
+		return packet.Frequency_Hz
+	}
+
+	return c.radioConfig.Frequency
+}
+
+// Configured LoRa parameters with the packet spreading factor applied.
+func (c *MeshtasticClient) loraParametersFor(packet *RawPacket) client.LoRaParameters {
+	params := c.radioConfig.LoRaParameters()
+
+	if packet.SpreadingFactor != 0 {
+		params.SpreadingFactor = packet.SpreadingFactor
+
+		if c.radioConfig.LowDataRate == nil {
+			params.LowDataRate = client.LowDataRateRequired(params.SpreadingFactor, params.Bandwidth)
+		}
+	}
+
+	return params
+}
+
+func (c *MeshtasticClient) timeOnAir(packet *RawPacket) time.Duration {
+	loraParams := c.loraParametersFor(packet)
+	packetParams := c.radioConfig.PacketParameters()
+
+	return client.TimeOnAir(&loraParams, &packetParams, len(packet.Data))
+}
+
+/*
+Tune the radio to the packet overrides before transmitting it,
+the configured frequency and modulation are restored once the transmission completes.
+*/
+func (c *MeshtasticClient) tune(packet *RawPacket) error {
+	if !packet.hasOverrides() {
+		return nil
+	}
+
+	c.retuned = true
+
+	return c.apiClient.Tune(c.frequencyFor(packet), c.loraParametersFor(packet))
+}
+
+func (c *MeshtasticClient) restoreTuning() error {
+	if !c.retuned {
+		return nil
+	}
+
+	c.retuned = false
+
+	return c.apiClient.Tune(c.radioConfig.Frequency, c.radioConfig.LoRaParameters())
+}
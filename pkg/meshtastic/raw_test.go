@@ -0,0 +1,64 @@
+package meshtastic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeshtasticClientRawMode(t *testing.T) {
+	meshtasticClient, radio := newEmulatedClient(t, &RadioConfiguration{
+		Region:          "EU_868",
+		Frequency:       869525000,
+		Power:           14,
+		SpreadingFactor: client.LORA_SF7,
+		Bandwidth:       client.LORA_BW_125,
+		CodingRate:      client.LORA_CR_4_5,
+		DutyCycle:       &DutyCycleConfiguration{Percent: 100},
+	}, func(c *MeshtasticClient) { c.SetRawMode(true) })
+
+	// Short frames are delivered, repeated ones too
+	frame := []byte{0x01, 0x02, 0x03}
+
+	for range 2 {
+		assert.NoError(t, radio.InjectPacket(frame, -90, 7))
+
+		select {
+		case received := <-meshtasticClient.IncomingPackets:
+			assert.Equal(t, frame, received.Data)
+			assert.Equal(t, int8(7), received.PacketSNR_dB)
+		case <-time.After(time.Second):
+			t.Fatal("packet has not been received")
+		}
+	}
+
+	// Transmitted with overrides, the configuration is restored afterwards
+	meshtasticClient.OutgoingRawPackets <- &RawPacket{
+		Data:            frame,
+		Frequency_Hz:    868100000,
+		SpreadingFactor: client.LORA_SF12,
+	}
+
+	select {
+	case transmitted := <-radio.Transmitted:
+		assert.Equal(t, frame, transmitted)
+	case <-time.After(3 * time.Second):
+		t.Fatal("packet has not been transmitted")
+	}
+
+	assert.Eventually(t, func() bool {
+		return radio.Frequency() == 869525000 && radio.LoRaParameters().SpreadingFactor == client.LORA_SF7 && radio.IsReceiving()
+	}, time.Second, 10*time.Millisecond)
+
+	// Outside of the regional bands
+	meshtasticClient.OutgoingRawPackets <- &RawPacket{Data: frame, Frequency_Hz: 880000000}
+
+	select {
+	case err := <-meshtasticClient.Errors:
+		assert.ErrorContains(t, err, "packet dropped")
+	case <-time.After(time.Second):
+		t.Fatal("packet has not been rejected")
+	}
+}
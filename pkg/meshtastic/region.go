@@ -0,0 +1,151 @@
+package meshtastic
+
+import (
+	"fmt"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+/*
+Meshtastic LoRa region, see the firmware RadioInterface.cpp regions table.
+The frequency range is the one the firmware spreads its frequency slots over.
+*/
+type Region struct {
+	Name              string
+	FrequencyStart_Hz uint32
+	FrequencyEnd_Hz   uint32
+	DutyCycle_percent uint32
+	PowerLimit_dBm    int32 // ERP
+
+	// Regulatory bands, the whole region range with its limits when empty
+	Bands []Band
+}
+
+/*
+Europe follows ERC Recommendation 70-03 (SRD sub-bands), the other regions
+use the limits of the Meshtastic firmware.
+*/
+var regions = []Region{
+	{"US", 902000000, 928000000, 100, 30, nil},
+	// The firmware slots start below the 433.05 MHz band edge
+	{"EU_433", 433000000, 434000000, 10, 10, []Band{
+		{"EU_433", 433050000, 434790000, 10, 10},
+	}},
+	{"EU_868", 869400000, 869650000, 10, 27, []Band{
+		{"EU_868 h1.3", 863000000, 865000000, 14, 0.1},
+		{"EU_868 h1.4", 865000000, 868000000, 14, 1},
+		{"EU_868 g1", 868000000, 868600000, 14, 1},
+		{"EU_868 g2", 868700000, 869200000, 14, 0.1},
+		{"EU_868 g3", 869400000, 869650000, 27, 10},
+		{"EU_868 g4", 869700000, 870000000, 14, 1},
+	}},
+	{"CN", 470000000, 510000000, 100, 19, nil},
+	{"JP", 920500000, 923500000, 100, 13, nil},
+	{"ANZ", 915000000, 928000000, 100, 30, nil},
+	{"KR", 920000000, 923000000, 100, 23, nil},
+	{"TW", 920000000, 925000000, 100, 27, nil},
+	{"RU", 868700000, 869200000, 100, 20, nil},
+	{"IN", 865000000, 867000000, 100, 30, nil},
+	{"NZ_865", 864000000, 868000000, 100, 36, nil},
+	{"TH", 920000000, 925000000, 100, 16, nil},
+	{"UA_433", 433000000, 434700000, 10, 10, nil},
+	{"UA_868", 868000000, 868600000, 1, 14, nil},
+	{"MY_433", 433000000, 435000000, 100, 20, nil},
+	{"MY_919", 919000000, 924000000, 100, 27, nil},
+	{"SG_923", 917000000, 925000000, 100, 20, nil},
+}
+
+func LookupRegion(name string) (*Region, error) {
+	for i := range regions {
+		if regions[i].Name == name {
+			return &regions[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown LoRa region '%s'", name)
+}
+
+// Regulatory bands of the region.
+func (r *Region) RegulatoryBands() []Band {
+	if len(r.Bands) > 0 {
+		return r.Bands
+	}
+
+	return []Band{
+		{r.Name, r.FrequencyStart_Hz, r.FrequencyEnd_Hz, r.PowerLimit_dBm, float64(r.DutyCycle_percent)},
+	}
+}
+
+// Number of frequency slots of the given bandwidth fitting the region.
+func (r *Region) FrequencySlots(bandwidth byte) uint32 {
+	bw := client.BandwidthHz(bandwidth)
+	if bw == 0 {
+		return 0
+	}
+
+	return (r.FrequencyEnd_Hz - r.FrequencyStart_Hz) / bw
+}
+
+// Center frequency of a zero-based frequency slot.
+func (r *Region) SlotFrequency(bandwidth byte, slot uint32) uint32 {
+	bw := client.BandwidthHz(bandwidth)
+
+	return r.FrequencyStart_Hz + bw/2 + slot*bw
+}
+
+/*
+Default frequency slot for a channel, the firmware hashes the primary
+channel name so that nodes sharing a channel end up on the same frequency.
+*/
+func (r *Region) DefaultFrequencySlot(bandwidth byte, channelName string) (uint32, error) {
+	slots := r.FrequencySlots(bandwidth)
+	if slots == 0 {
+		return 0, fmt.Errorf("LoRa bandwidth does not fit the %s region", r.Name)
+	}
+
+	return ChannelNameHash(channelName) % slots, nil
+}
+
+// djb2 string hash, as used by the firmware to pick the frequency slot.
+func ChannelNameHash(name string) uint32 {
+	var hash uint32 = 5381
+
+	for _, c := range []byte(name) {
+		hash = (hash << 5) + hash + uint32(c)
+	}
+
+	return hash
+}
+
+//------------------------------------------------------------------------------
+
+// Meshtastic modem preset.
+type ModemPreset struct {
+	Name            string
+	DisplayName     string // Default primary channel name
+	SpreadingFactor byte
+	Bandwidth       byte
+	CodingRate      byte
+}
+
+var modemPresets = []ModemPreset{
+	{"SHORT_TURBO", "ShortTurbo", client.LORA_SF7, client.LORA_BW_500, client.LORA_CR_4_5},
+	{"SHORT_FAST", "ShortFast", client.LORA_SF7, client.LORA_BW_250, client.LORA_CR_4_5},
+	{"SHORT_SLOW", "ShortSlow", client.LORA_SF8, client.LORA_BW_250, client.LORA_CR_4_5},
+	{"MEDIUM_FAST", "MediumFast", client.LORA_SF9, client.LORA_BW_250, client.LORA_CR_4_5},
+	{"MEDIUM_SLOW", "MediumSlow", client.LORA_SF10, client.LORA_BW_250, client.LORA_CR_4_5},
+	{"LONG_FAST", "LongFast", client.LORA_SF11, client.LORA_BW_250, client.LORA_CR_4_5},
+	{"LONG_MODERATE", "LongMod", client.LORA_SF11, client.LORA_BW_125, client.LORA_CR_4_8},
+	{"LONG_SLOW", "LongSlow", client.LORA_SF12, client.LORA_BW_125, client.LORA_CR_4_8},
+	{"VERY_LONG_SLOW", "VLongSlow", client.LORA_SF12, client.LORA_BW_062, client.LORA_CR_4_8},
+}
+
+func LookupModemPreset(name string) (*ModemPreset, error) {
+	for i := range modemPresets {
+		if modemPresets[i].Name == name {
+			return &modemPresets[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown modem preset '%s'", name)
+}
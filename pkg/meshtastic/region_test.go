@@ -0,0 +1,47 @@
+package meshtastic
+
+import (
+	"testing"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionDefaultFrequency(t *testing.T) {
+	us, err := LookupRegion("US")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(104), us.FrequencySlots(client.LORA_BW_250))
+
+	slot, err := us.DefaultFrequencySlot(client.LORA_BW_250, "LongFast")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(19), slot)
+	assert.Equal(t, uint32(906875000), us.SlotFrequency(client.LORA_BW_250, slot))
+
+	slot, err = us.DefaultFrequencySlot(client.LORA_BW_250, "MediumFast")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(913125000), us.SlotFrequency(client.LORA_BW_250, slot))
+
+	eu, err := LookupRegion("EU_868")
+	assert.NoError(t, err)
+
+	slot, err = eu.DefaultFrequencySlot(client.LORA_BW_250, "LongFast")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(869525000), eu.SlotFrequency(client.LORA_BW_250, slot))
+
+	_, err = eu.DefaultFrequencySlot(client.LORA_BW_500, "ShortTurbo")
+	assert.Error(t, err)
+
+	_, err = LookupRegion("MARS")
+	assert.Error(t, err)
+}
+
+func TestModemPreset(t *testing.T) {
+	preset, err := LookupModemPreset("LONG_SLOW")
+	assert.NoError(t, err)
+	assert.Equal(t, byte(client.LORA_SF12), preset.SpreadingFactor)
+	assert.Equal(t, byte(client.LORA_BW_125), preset.Bandwidth)
+	assert.Equal(t, byte(client.LORA_CR_4_8), preset.CodingRate)
+
+	_, err = LookupModemPreset("LUDICROUS_SPEED")
+	assert.Error(t, err)
+}
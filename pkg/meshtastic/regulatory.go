@@ -0,0 +1,74 @@
+package meshtastic
+
+import (
+	"fmt"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+// Conversion of antenna gains from dBi (isotropic) to dBd (dipole), EIRP = ERP + 2.15 dB
+const DIPOLE_GAIN_dBi = 2.15
+
+// Frequency band with its regulatory limits, see the regions table.
+type Band struct {
+	Name              string
+	FrequencyStart_Hz uint32
+	FrequencyEnd_Hz   uint32
+	PowerLimit_dBm    int32   // ERP
+	DutyCycle_percent float64 // 100 when not limited
+}
+
+// Find the band of the region fully containing the channel.
+func LookupBand(region string, frequency_Hz uint32, bandwidth byte) (*Band, error) {
+	r, err := LookupRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	bands := r.RegulatoryBands()
+
+	bw := client.BandwidthHz(bandwidth)
+	if bw == 0 {
+		return nil, fmt.Errorf("unknown LoRa bandwidth %d", bandwidth)
+	}
+
+	low := frequency_Hz - bw/2
+	high := frequency_Hz + bw/2
+
+	for i := range bands {
+		if low >= bands[i].FrequencyStart_Hz && high <= bands[i].FrequencyEnd_Hz {
+			return &bands[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("channel %d-%d Hz does not fit any %s band", low, high, region)
+}
+
+/*
+Check the radio configuration against the regulatory limits of its region:
+the whole channel must fit a band, the ERP must not exceed the band limit
+and the band duty cycle must be known. The antenna gain is given in dBi,
+so the ERP is the power plus the gain less the 2.15 dBi of a dipole.
+*/
+func (r *RadioConfiguration) Validate() error {
+	if r.Region == "" {
+		return fmt.Errorf("radio region is not configured")
+	}
+
+	band, err := LookupBand(r.Region, r.Frequency, byte(r.Bandwidth))
+	if err != nil {
+		return err
+	}
+
+	erp := float64(int32(r.Power)+r.AntennaGain) - DIPOLE_GAIN_dBi
+	if erp > float64(band.PowerLimit_dBm) {
+		return fmt.Errorf("%.2f dBm ERP (%d dBm power, %d dBi antenna gain) exceeds the %d dBm ERP limit of the %s band",
+			erp, r.Power, r.AntennaGain, band.PowerLimit_dBm, band.Name)
+	}
+
+	if band.DutyCycle_percent <= 0 {
+		return fmt.Errorf("duty cycle limit of the %s band is unknown", band.Name)
+	}
+
+	return nil
+}
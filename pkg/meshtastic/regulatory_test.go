@@ -0,0 +1,73 @@
+package meshtastic
+
+import (
+	"testing"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupBand(t *testing.T) {
+	band, err := LookupBand("EU_868", 869525000, client.LORA_BW_250)
+	assert.NoError(t, err)
+	assert.Equal(t, "EU_868 g3", band.Name)
+	assert.Equal(t, 10.0, band.DutyCycle_percent)
+
+	band, err = LookupBand("EU_868", 868100000, client.LORA_BW_125)
+	assert.NoError(t, err)
+	assert.Equal(t, "EU_868 g1", band.Name)
+
+	// Crosses the g1 upper edge
+	_, err = LookupBand("EU_868", 868500000, client.LORA_BW_250)
+	assert.Error(t, err)
+
+	_, err = LookupBand("MARS", 868100000, client.LORA_BW_125)
+	assert.Error(t, err)
+
+	// The regulatory band, not the firmware slot range
+	_, err = LookupBand("EU_433", 433062500, client.LORA_BW_125)
+	assert.Error(t, err)
+
+	band, err = LookupBand("EU_433", 434000000, client.LORA_BW_125)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(10), band.PowerLimit_dBm)
+
+	// Regions without sub-bands are a single band
+	band, err = LookupBand("US", 906875000, client.LORA_BW_250)
+	assert.NoError(t, err)
+	assert.Equal(t, Band{"US", 902000000, 928000000, 30, 100}, *band)
+}
+
+func TestRadioConfigurationValidate(t *testing.T) {
+	cfg := RadioConfiguration{
+		Region:    "EU_868",
+		Frequency: 869525000,
+		Power:     22,
+		Bandwidth: client.LORA_BW_250,
+	}
+	assert.NoError(t, cfg.Validate())
+
+	// 22 + 6 - 2.15 dBm ERP
+	cfg.AntennaGain = 6
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AntennaGain = 8
+	assert.Error(t, cfg.Validate())
+
+	cfg.AntennaGain = 0
+	cfg.Frequency = 868300000
+	cfg.Bandwidth = client.LORA_BW_125
+	assert.Error(t, cfg.Validate())
+
+	cfg.Power = 14
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Frequency = 915000000
+	assert.Error(t, cfg.Validate())
+
+	cfg.Region = "US"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Region = ""
+	assert.Error(t, cfg.Validate())
+}
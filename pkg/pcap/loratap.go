@@ -0,0 +1,71 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+)
+
+const (
+	LINKTYPE_LORATAP = 270
+
+	LORATAP_VERSION       = 0
+	LORATAP_HEADER_LENGTH = 15
+)
+
+/*
+LoRaTap pseudo header (version 0) describing a received LoRa packet.
+See https://github.com/eriknl/LoRaTap
+*/
+type LoRaTap struct {
+	Frequency_Hz    uint32
+	Bandwidth       byte // LORA_BW_xxx
+	SpreadingFactor byte
+	PacketRssi_dBm  int
+	MaxRssi_dBm     int
+	CurrentRssi_dBm int
+	Snr_dB          float64
+	SyncWord        byte
+}
+
+// RSSI in the LoRaTap encoding, dBm = -139 + value.
+func encodeRssi(rssi_dBm int) byte {
+	return byte(max(0, min(rssi_dBm+139, 255)))
+}
+
+// Check that the header fields can be represented in the LoRaTap encoding.
+func (h *LoRaTap) Validate() error {
+	// Bandwidth in 125 kHz steps
+	hz := client.BandwidthHz(h.Bandwidth)
+	if hz == 0 || hz%125000 != 0 {
+		return fmt.Errorf("bandwidth %d Hz can't be represented in LoRaTap, only multiples of 125 kHz are", hz)
+	}
+
+	return nil
+}
+
+// Append the header followed by the LoRa payload.
+func (h *LoRaTap) Append(buffer []byte, payload []byte) []byte {
+	// Bandwidth in 125 kHz steps, narrower bandwidths can't be represented
+	bandwidth := byte(client.BandwidthHz(h.Bandwidth) / 125000)
+
+	// SNR in 0.25 dB steps
+	snr := int8(max(math.MinInt8, min(math.Round(h.Snr_dB*4), math.MaxInt8)))
+
+	buffer = append(buffer, LORATAP_VERSION, 0)
+	buffer = binary.BigEndian.AppendUint16(buffer, LORATAP_HEADER_LENGTH)
+	buffer = binary.BigEndian.AppendUint32(buffer, h.Frequency_Hz)
+	buffer = append(buffer,
+		bandwidth,
+		h.SpreadingFactor,
+		encodeRssi(h.PacketRssi_dBm),
+		encodeRssi(h.MaxRssi_dBm),
+		encodeRssi(h.CurrentRssi_dBm),
+		byte(snr),
+		h.SyncWord,
+	)
+
+	return append(buffer, payload...)
+}
@@ -0,0 +1,89 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	PCAP_MAGIC         = 0xA1B2C3D4
+	PCAP_VERSION_MAJOR = 2
+	PCAP_VERSION_MINOR = 4
+	PCAP_SNAPLEN       = 65535
+)
+
+/*
+Writer of classic libpcap capture files.
+See https://www.tcpdump.org/manpages/pcap-savefile.5.html
+*/
+type Writer struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	buffer []byte
+}
+
+// Write the file header for the link type.
+func NewWriter(w io.Writer, linkType uint32) (*Writer, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], PCAP_MAGIC)
+	binary.LittleEndian.PutUint16(header[4:6], PCAP_VERSION_MAJOR)
+	binary.LittleEndian.PutUint16(header[6:8], PCAP_VERSION_MINOR)
+	// Time zone and timestamp accuracy are left zero
+	binary.LittleEndian.PutUint32(header[16:20], PCAP_SNAPLEN)
+	binary.LittleEndian.PutUint32(header[20:24], linkType)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w}, nil
+}
+
+// Create a capture file, overwriting an existing one.
+func Create(path string, linkType uint32) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := NewWriter(f, linkType)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	writer.closer = f
+
+	return writer, nil
+}
+
+// Append a packet record.
+func (p *Writer) WritePacket(timestamp time.Time, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	length := min(len(data), PCAP_SNAPLEN)
+
+	p.buffer = p.buffer[:0]
+	p.buffer = binary.LittleEndian.AppendUint32(p.buffer, uint32(timestamp.Unix()))
+	p.buffer = binary.LittleEndian.AppendUint32(p.buffer, uint32(timestamp.Nanosecond()/1000))
+	p.buffer = binary.LittleEndian.AppendUint32(p.buffer, uint32(length))
+	p.buffer = binary.LittleEndian.AppendUint32(p.buffer, uint32(len(data)))
+	p.buffer = append(p.buffer, data[:length]...)
+
+	_, err := p.w.Write(p.buffer)
+
+	return err
+}
+
+func (p *Writer) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+
+	return p.closer.Close()
+}
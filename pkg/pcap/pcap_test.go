@@ -0,0 +1,71 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/Archie3d/waveshare-usb-lora-client/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	var buffer bytes.Buffer
+
+	writer, err := NewWriter(&buffer, LINKTYPE_LORATAP)
+	assert.NoError(t, err)
+
+	timestamp := time.Unix(1700000000, 250000000)
+	assert.NoError(t, writer.WritePacket(timestamp, []byte{0x01, 0x02, 0x03}))
+
+	data := buffer.Bytes()
+	assert.Equal(t, 24+16+3, len(data))
+
+	assert.Equal(t, uint32(PCAP_MAGIC), binary.LittleEndian.Uint32(data[0:4]))
+	assert.Equal(t, uint32(LINKTYPE_LORATAP), binary.LittleEndian.Uint32(data[20:24]))
+
+	record := data[24:]
+	assert.Equal(t, uint32(1700000000), binary.LittleEndian.Uint32(record[0:4]))
+	assert.Equal(t, uint32(250000), binary.LittleEndian.Uint32(record[4:8]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(record[8:12]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(record[12:16]))
+	assert.Equal(t, []byte{0x01, 0x02, 0x03}, record[16:])
+}
+
+func TestLoRaTap(t *testing.T) {
+	header := LoRaTap{
+		Frequency_Hz:    869525000,
+		Bandwidth:       client.LORA_BW_250,
+		SpreadingFactor: client.LORA_SF11,
+		PacketRssi_dBm:  -80,
+		MaxRssi_dBm:     -80,
+		CurrentRssi_dBm: -110,
+		Snr_dB:          -7.5,
+		SyncWord:        0x2B,
+	}
+
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x0F,
+		0x33, 0xD3, 0xE6, 0x08,
+		0x02, 0x0B,
+		59, 59, 29,
+		0xE2,
+		0x2B,
+		0xAA,
+	}, header.Append(nil, []byte{0xAA}))
+}
+
+func TestLoRaTapBandwidth(t *testing.T) {
+	header := LoRaTap{Bandwidth: client.LORA_BW_250}
+	assert.NoError(t, header.Validate())
+
+	header.Bandwidth = client.LORA_BW_500
+	assert.NoError(t, header.Validate())
+
+	header.Bandwidth = client.LORA_BW_062
+	assert.Error(t, header.Validate())
+
+	header.Bandwidth = client.LORA_BW_007
+	assert.Error(t, header.Validate())
+}
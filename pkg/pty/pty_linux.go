@@ -0,0 +1,106 @@
+package pty
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Run a raw syscall on the file descriptor without switching it to blocking mode.
+func control(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	err = conn.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+
+	return fnErr
+}
+
+/*
+Allocate a pseudo terminal in raw mode.
+Returns the master side and the slave side, the latter is kept open
+so that the master does not fail while no client is connected.
+*/
+func Open() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ptyNumber int
+
+	err = control(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return err
+		}
+
+		n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+		ptyNumber = n
+		return err
+	})
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptyNumber), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	if err := makeRaw(slave); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+/*
+Open the slave side of an existing pseudo terminal in raw mode, so that
+binary frames are not altered by the line discipline (echo, CR/LF mapping).
+*/
+func OpenRaw(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := makeRaw(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func makeRaw(f *os.File) error {
+	return control(f, func(fd int) error {
+		termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if err != nil {
+			return err
+		}
+
+		// Equivalent of cfmakeraw()
+		termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		termios.Oflag &^= unix.OPOST
+		termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		termios.Cflag &^= unix.CSIZE | unix.PARENB
+		termios.Cflag |= unix.CS8
+		termios.Cc[unix.VMIN] = 1
+		termios.Cc[unix.VTIME] = 0
+
+		return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package pty
+
+import (
+	"fmt"
+	"os"
+)
+
+func Open() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("pseudo terminals are only supported on Linux")
+}
+
+func OpenRaw(path string) (*os.File, error) {
+	return nil, fmt.Errorf("pseudo terminals are only supported on Linux")
+}
@@ -11,3 +11,9 @@ type BusyError struct{}
 func (e *BusyError) Error() string {
 	return "busy"
 }
+
+type DisconnectedError struct{}
+
+func (e *DisconnectedError) Error() string {
+	return "disconnected"
+}